@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urban-wombat/flattables"
+	"github.com/urban-wombat/gotables"
+)
+
+/*
+	Subcommand csv converts a directory of CSV files (one per table, named <TableName>.csv)
+	to a FlatTables FlatBuffers binary file, using the tables in a gotables file as the schema.
+
+	The binary file can be read by the package that flattablesc generated from the same gotables file.
+*/
+
+var csvUsageSlice []string = []string{
+	"usage:       ${globalUtilName} csv -f <gotables-file> -i <csv-dir> -o <out-file> [-l <layout>]",
+	"purpose:     Convert a directory of CSV files, one per table, to a FlatTables FlatBuffers binary file.",
+	"flags:   -f  The gotables file given to ${globalUtilName} to generate the package. Its tables are the schema.",
+	"         -i  <csv-dir> containing a file <TableName>.csv for each table in <gotables-file>.",
+	"             Each CSV file has a header row of col names, then a row per table row.",
+	"         -o  <out-file> FlatTables FlatBuffers binary file to write.",
+	"        [-l] <layout> nested (default) or single. Must match the -l the package was generated with.",
+	"        [-v] Verbose",
+}
+
+func csvCommand(args []string) {
+	var f string // <gotables-file>
+	var i string // <csv-dir>
+	var o string // <out-file>
+	var l string // <layout>
+	var v bool   // verbose
+
+	flagSet := flag.NewFlagSet(globalUtilName+" csv", flag.ExitOnError)
+	flagSet.Usage = func() { printSubcommandUsage(csvUsageSlice) }
+	flagSet.StringVar(&f, "f", "", "<gotables-file> schema of tables")
+	flagSet.StringVar(&i, "i", "", "<csv-dir> of CSV files named <TableName>.csv")
+	flagSet.StringVar(&o, "o", "", "<out-file> FlatTables FlatBuffers binary file")
+	flagSet.StringVar(&l, "l", flattables.NestedLayout, fmt.Sprintf("<layout> of root table FlatTables: %s or %s", flattables.NestedLayout, flattables.SingleLayout))
+	flagSet.BoolVar(&v, "v", false, "verbose")
+	_ = flagSet.Parse(args)
+
+	if f == "" || i == "" || o == "" {
+		fmt.Fprintf(os.Stderr, "compulsory flags: -f -i -o\n")
+		printSubcommandUsage(csvUsageSlice)
+		os.Exit(2)
+	}
+
+	if v {
+		fmt.Printf(" (1) Reading gotables file: %s\n", f)
+	}
+	schema, err := gotables.NewTableSetFromFile(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(14)
+	}
+
+	if v {
+		fmt.Printf(" (2) Reading CSV files from: %s\n", i)
+	}
+	flatBuffers, err := flattables.NewFlatBuffersFromCSVDir(schema, i, l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(21)
+	}
+
+	if v {
+		fmt.Printf(" (3) Writing %d bytes (layout %s) to: %s\n", len(flatBuffers), l, o)
+	}
+	err = ioutil.WriteFile(o, flatBuffers, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(20)
+	}
+}
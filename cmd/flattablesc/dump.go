@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urban-wombat/flattables"
+	"github.com/urban-wombat/gotables"
+)
+
+/*
+	Subcommand dump prints a FlatTables FlatBuffers binary file as gotables text, or as JSON,
+	decoding it with flattables.DecodeLayout() and the tables in a gotables file as the schema,
+	or without one the metadata that the file embeds (see flattables.MetadataAnnotation).
+
+	It needs no generated package, so it can look inside a file (such as a production payload)
+	without writing and compiling a program against the package that flattablesc generated.
+*/
+
+var dumpUsageSlice []string = []string{
+	"usage:       ${globalUtilName} dump [-f <gotables-file>] [-l <layout>] [-j] [-t <tables>] [-c <cols>] [-n <rows>] <in-file>",
+	"purpose:     Print a FlatTables FlatBuffers binary file as gotables text (or JSON), without the generated package.",
+	"flags:  [-f] The gotables file given to ${globalUtilName} to generate the package. Its tables are the schema.",
+	"             Default: the metadata embedded in <in-file>, if encoded from a file with //flattables:metadata.",
+	"        [-l] <layout> nested (default) or single. Must match the -l the package was generated with.",
+	"        [-j] Print JSON: {\"Table1\":[{\"col1\":1,\"col2\":\"a\"},...],\"Table2\":[...]} as the generated WriteJSON() writes it.",
+	"        [-t] <tables> Comma-separated names of the tables to print. Default: all tables.",
+	"        [-c] <cols> Comma-separated names of the cols to print, of any table, or of one table as <TableName>.<colName>.",
+	"             Tables with none of the cols are left out. Default: all cols.",
+	"        [-n] <rows> Print at most the first <rows> rows of each table. Default: all rows.",
+	"             <in-file> FlatTables FlatBuffers binary file to print.",
+}
+
+func dumpCommand(args []string) {
+	var f string // <gotables-file>
+	var l string // <layout>
+	var j bool   // JSON
+	var t string // <tables>
+	var c string // <cols>
+	var n int    // <rows>
+
+	flagSet := flag.NewFlagSet(globalUtilName+" dump", flag.ExitOnError)
+	flagSet.Usage = func() { printSubcommandUsage(dumpUsageSlice) }
+	flagSet.StringVar(&f, "f", "", "<gotables-file> schema of tables")
+	flagSet.StringVar(&l, "l", flattables.NestedLayout, fmt.Sprintf("<layout> of root table FlatTables: %s or %s", flattables.NestedLayout, flattables.SingleLayout))
+	flagSet.BoolVar(&j, "j", false, "print JSON")
+	flagSet.StringVar(&t, "t", "", "<tables> comma-separated table names")
+	flagSet.StringVar(&c, "c", "", "<cols> comma-separated col names")
+	flagSet.IntVar(&n, "n", -1, "<rows> per table")
+
+	// Flags may come before or after <in-file>.
+	var inFiles []string
+	for {
+		_ = flagSet.Parse(args)
+		if flagSet.NArg() == 0 {
+			break
+		}
+		inFiles = append(inFiles, flagSet.Arg(0))
+		args = flagSet.Args()[1:]
+	}
+
+	if len(inFiles) != 1 {
+		fmt.Fprintf(os.Stderr, "compulsory: one <in-file>\n")
+		printSubcommandUsage(dumpUsageSlice)
+		os.Exit(2)
+	}
+	var inFile string = inFiles[0]
+
+	flatBuffers, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(14)
+	}
+
+	var schema *gotables.TableSet
+	if f != "" {
+		schema, err = gotables.NewTableSetFromFile(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(14)
+		}
+	} else {
+		// The embedded metadata has the annotations too, so flattables.DecodeLayout() needs nothing else.
+		schema, err = flattables.MetadataFromFlatBuffers(flatBuffers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s (without -f <gotables-file>)\n", inFile, err)
+			os.Exit(26)
+		}
+	}
+
+	tableSet, err := flattables.DecodeLayout(flatBuffers, schema, l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", inFile, err)
+		os.Exit(26)
+	}
+
+	tableSet, err = projectTableSet(tableSet, commaList(t), commaList(c), n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
+
+	var out []byte
+	if j {
+		out, err = tableSetJSON(tableSet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", inFile, err)
+			os.Exit(26)
+		}
+		out = append(out, '\n')
+	} else {
+		out = []byte(tableSet.String())
+	}
+
+	_, err = os.Stdout.Write(out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(20)
+	}
+}
+
+// commaList() returns the non-empty names of comma-separated list s.
+func commaList(s string) (names []string) {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+/*
+projectTableSet() returns the tables of tableSet named in tableNames (or all tables if none), with the cols named
+in colNames (or all cols if none), and at most rowLimit rows (or all rows if rowLimit is negative).
+
+A col name is of any table with the col, or of one table as <TableName>.<colName>. Tables with none of colNames are
+left out. A name of no table or col is an error. These are the rules of ?tables= and ?cols= of the generated Handler.
+*/
+func projectTableSet(tableSet *gotables.TableSet, tableNames []string, colNames []string, rowLimit int) (*gotables.TableSet, error) {
+	for _, tableName := range tableNames {
+		hasTable, err := tableSet.HasTable(tableName)
+		if err != nil {
+			return nil, err
+		}
+		if !hasTable {
+			return nil, fmt.Errorf("-t %s: no such table", tableName)
+		}
+	}
+
+	// The names of the cols selected of each table, or nil for all cols.
+	var tableColNames map[string][]string
+	if len(colNames) > 0 {
+		tableColNames = make(map[string][]string)
+		for _, colName := range colNames {
+			tableName, bareColName := "", colName
+			if dot := strings.IndexByte(colName, '.'); dot >= 0 {
+				tableName, bareColName = colName[:dot], colName[dot+1:]
+				hasTable, err := tableSet.HasTable(tableName)
+				if err != nil {
+					return nil, err
+				}
+				if !hasTable {
+					return nil, fmt.Errorf("-c %s: no such table", colName)
+				}
+			}
+
+			var found bool
+			for tableIndex := 0; tableIndex < tableSet.TableCount(); tableIndex++ {
+				table, err := tableSet.TableByTableIndex(tableIndex)
+				if err != nil {
+					return nil, err
+				}
+				if tableName != "" && tableName != table.Name() {
+					continue
+				}
+				hasCol, err := table.HasCol(bareColName)
+				if err != nil {
+					return nil, err
+				}
+				if hasCol {
+					tableColNames[table.Name()] = append(tableColNames[table.Name()], bareColName)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("-c %s: no such col", colName)
+			}
+		}
+	}
+
+	projected, err := gotables.NewTableSet(tableSet.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	for tableIndex := 0; tableIndex < tableSet.TableCount(); tableIndex++ {
+		table, err := tableSet.TableByTableIndex(tableIndex)
+		if err != nil {
+			return nil, err
+		}
+		if len(tableNames) > 0 && !contains(tableNames, table.Name()) {
+			continue
+		}
+
+		// The cols in table order, whatever the order of colNames.
+		var colIndexes []int
+		var projectedColNames []string
+		var projectedColTypes []string
+		for colIndex := 0; colIndex < table.ColCount(); colIndex++ {
+			colName, err := table.ColNameByColIndex(colIndex)
+			if err != nil {
+				return nil, err
+			}
+			if tableColNames != nil && !contains(tableColNames[table.Name()], colName) {
+				continue
+			}
+			colType, err := table.ColTypeByColIndex(colIndex)
+			if err != nil {
+				return nil, err
+			}
+			colIndexes = append(colIndexes, colIndex)
+			projectedColNames = append(projectedColNames, colName)
+			projectedColTypes = append(projectedColTypes, colType)
+		}
+		if len(colIndexes) == 0 {
+			continue
+		}
+
+		var rowCount int = table.RowCount()
+		if rowLimit >= 0 && rowLimit < rowCount {
+			rowCount = rowLimit
+		}
+
+		projectedTable, err := gotables.NewTableFromMetadata(table.Name(), projectedColNames, projectedColTypes)
+		if err != nil {
+			return nil, err
+		}
+		err = projectedTable.AppendRows(rowCount)
+		if err != nil {
+			return nil, err
+		}
+		for projectedColIndex, colIndex := range colIndexes {
+			for rowIndex := 0; rowIndex < rowCount; rowIndex++ {
+				val, err := table.GetValByColIndex(colIndex, rowIndex)
+				if err != nil {
+					return nil, err
+				}
+				err = projectedTable.SetValByColIndex(projectedColIndex, rowIndex, val)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		err = projected.AppendTable(projectedTable)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return projected, nil
+}
+
+// contains() returns whether names contains name.
+func contains(names []string, name string) bool {
+	for _, s := range names {
+		if s == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+tableSetJSON() returns the tables of tableSet as the JSON of the generated WriteJSON() and RootTableSlice.MarshalJSON():
+an object of each table as an array of an object of each row. JSON has no NaN or infinity: such a float is an error.
+*/
+func tableSetJSON(tableSet *gotables.TableSet) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for tableIndex := 0; tableIndex < tableSet.TableCount(); tableIndex++ {
+		table, err := tableSet.TableByTableIndex(tableIndex)
+		if err != nil {
+			return nil, err
+		}
+		if tableIndex > 0 {
+			buffer.WriteByte(',')
+		}
+		err = writeJSONValue(&buffer, table.Name())
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString(":[")
+
+		for rowIndex := 0; rowIndex < table.RowCount(); rowIndex++ {
+			if rowIndex > 0 {
+				buffer.WriteByte(',')
+			}
+			buffer.WriteByte('{')
+			for colIndex := 0; colIndex < table.ColCount(); colIndex++ {
+				colName, err := table.ColNameByColIndex(colIndex)
+				if err != nil {
+					return nil, err
+				}
+				val, err := table.GetValByColIndex(colIndex, rowIndex)
+				if err != nil {
+					return nil, err
+				}
+				if colIndex > 0 {
+					buffer.WriteByte(',')
+				}
+				err = writeJSONValue(&buffer, colName)
+				if err != nil {
+					return nil, err
+				}
+				buffer.WriteByte(':')
+				err = writeJSONValue(&buffer, val)
+				if err != nil {
+					return nil, fmt.Errorf("[%s] col %s row %d: %v", table.Name(), colName, rowIndex, err)
+				}
+			}
+			buffer.WriteByte('}')
+		}
+		buffer.WriteByte(']')
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// writeJSONValue() writes val to buffer as JSON. Floats are formatted as the generated appendJSONFloat() formats them.
+func writeJSONValue(buffer *bytes.Buffer, val interface{}) error {
+	switch val := val.(type) {
+	case float32:
+		return writeJSONFloat(buffer, float64(val), 32)
+	case float64:
+		return writeJSONFloat(buffer, val, 64)
+	}
+
+	jsonBytes, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	buffer.Write(jsonBytes)
+
+	return nil
+}
+
+// writeJSONFloat() writes f to buffer as a JSON number. bitSize is 32 for float32 and 64 for float64.
+func writeJSONFloat(buffer *bytes.Buffer, f float64, bitSize int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("JSON has no value for float %v", f)
+	}
+	buffer.WriteString(strconv.FormatFloat(f, 'g', -1, bitSize))
+
+	return nil
+}
@@ -27,7 +27,8 @@ type Flags struct {
 	o string // <out-dir-package>
 	O string // <out-dir-package>
 	s string // <out-dir-main>	defaults to <out-dir-package>/cmd/<package-name>.go
-	m bool   // mutable	// Note: mutable (non-const) FlatBuffers apparently unavailable in Go
+	l string // <layout> nested (default) or single
+	m bool   // mutable	// Note: flatc generates Go Mutate...() methods with or without --gen-mutable
 	v bool   // verbose
 	d bool   // Dry Run
 	h bool   // help
@@ -42,7 +43,7 @@ var globalPackageName string        // from flags.p
 var globalOutDirAbsolute string     // from (optional) flags.o or flags.O via filepath.Abs()
 var globalFlagOWarnOnly bool        // if flags.O (capital O) is set
 var globalOutDirMainAbsolute string // from (optional) flags.s via filepath.Abs()
-var globalMutableFlag string        // Pass to flatc. Note: mutable (non-const) FlatBuffers apparently unavailable in Go.
+var globalMutableFlag string        // Pass to flatc. Note: flatc generates Go Mutate...() methods with or without it.
 var globalUtilName string = "flattablesc"
 var globalUtilDir string = "../flattables/cmd/flattablesc"
 
@@ -89,6 +90,7 @@ func initFlags() {
 	flag.StringVar(&flags.o, "o", "", fmt.Sprintf("<out-dir> Default is ../<namespace>"))
 	flag.StringVar(&flags.O, "O", "", fmt.Sprintf("<out-dir> Default is ../<namespace>"))
 	flag.StringVar(&flags.s, "s", "", fmt.Sprintf("<sample-main-out-dir> Default is ../<out-dir>/cmd/<namespace>"))
+	flag.StringVar(&flags.l, "l", flattables.NestedLayout, fmt.Sprintf("<layout> of root table FlatTables: %s or %s", flattables.NestedLayout, flattables.SingleLayout))
 	flag.BoolVar(&flags.m, "m", false, fmt.Sprintf("generate additional non-const accessors for mutating FlatBuffers in-place"))
 	flag.BoolVar(&flags.v, "v", false, fmt.Sprintf("verbose"))
 	flag.BoolVar(&flags.d, "d", false, fmt.Sprintf("dry run"))
@@ -134,6 +136,15 @@ func initFlags() {
 		os.Exit(9)
 	}
 
+	// Layout
+	switch flags.l {
+	case flattables.NestedLayout, flattables.SingleLayout:
+	default:
+		fmt.Fprintf(os.Stderr, "invalid <layout> -l %q (expecting %s or %s)\n", flags.l, flattables.NestedLayout, flattables.SingleLayout)
+		printUsage()
+		os.Exit(12)
+	}
+
 	if flags.m {
 		globalMutableFlag = "--gen-mutable" // Generate additional non-const accessors to mutate FlatBuffers in-place.
 	}
@@ -253,7 +264,7 @@ func checkStringFlagReplaceWithUtilVersion(name string, arg string, compulsory b
 
 func printUsage() {
 	var usageSlice []string = []string{
-		"usage:       ${globalUtilName} [-v] [-d] -f <gotables-file> -n <namespace> -p <package-name> [-o <out-dir>] [-s <out-dir-main>]",
+		"usage:       ${globalUtilName} [-v] [-d] -f <gotables-file> -n <namespace> -p <package-name> [-o <out-dir>] [-s <out-dir-main>] [-l <layout>]",
 		"purpose: (1) Generate a FlatBuffers schema file <namespace>.fbs from a set of tables.",
 		"         (2) Generate official Flatbuffers Go code (from <namespace>.fbs) using flatc --go",
 		"         (3) Generate additional Go code to read/write these specific table types from gotables objects.",
@@ -271,7 +282,12 @@ func printUsage() {
 		"        [-O] <out-dir> Allow generated code to go where <out-dir> does NOT match -p <package-name> (will print WARNING)",
 		"             Note: go test will work, but main will not be able to find its package",
 		"        [-s] <out-dir-main> Where to put generated sample main Go code file. Default is <out-dir>/cmd/<package-name>",
-		//		"         -m  Mutable  Tells flatc to add mutable methods to its Go code generation: Mutate...()",
+		"        [-l] <layout> How the data tables are stored in root table FlatTables:",
+		"             nested  (default) Each table is built separately and stored as a nested_flatbuffer. Tables can be extracted individually.",
+		"             single  All tables are built in one builder as direct child tables of FlatTables. Avoids copying each table twice.",
+		"        [-m] Mutable  Passes --gen-mutable to flatc. Not needed for Go: flatc always generates Go Mutate...() methods,",
+		"             and ${globalUtilName} always generates Set<ColName>() on each table to update scalar cells in place.",
+		"             To update a FlatTables file in place, open it with the generated OpenFileForUpdate().",
 		"types:       Architecture-dependent Go types int and uint are not used. Instead use e.g. int64, uint32, etc.",
 		"             Go types not implemented: complex32 complex64.",
 		//		"names:       Table names are UpperCamelCase, column names are lowerCamelCase, as per the FlatBuffers style guide.",
@@ -279,6 +295,16 @@ func printUsage() {
 		"        [-v] Verbose",
 		"        [-d] Dry run (also turns on Verbose)",
 		"        [-h] Help",
+		"subcommands: ${globalUtilName} csv -f <gotables-file> -i <csv-dir> -o <out-file> [-l <layout>]",
+		"             Convert a directory of CSV files (one per table) to a FlatTables FlatBuffers binary file.",
+		"             Run ${globalUtilName} csv -h for details.",
+		"             ${globalUtilName} sign -a <algorithm> -k <key-file> -i <in-file> -o <out-file>",
+		"             ${globalUtilName} verify -a <algorithm> -k <key-file> -i <in-file> [-o <out-file>]",
+		"             Sign a FlatTables FlatBuffers binary file with HMAC-SHA256 or Ed25519, and verify a signed file.",
+		"             Run ${globalUtilName} sign -h or ${globalUtilName} verify -h for details.",
+		"             ${globalUtilName} dump -f <gotables-file> [-l <layout>] [-j] [-t <tables>] [-c <cols>] [-n <rows>] <in-file>",
+		"             Print a FlatTables FlatBuffers binary file as gotables text (or JSON), without the generated package.",
+		"             Run ${globalUtilName} dump -h for details.",
 		"sample:      This sample assumes package name \"github.com/urban-wombat/flattables_sample\".",
 		"             Make a Go package dir: $ mkdir flattables_sample",
 		"             $ cd flattables_sample",
@@ -310,6 +336,18 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "%s\n", usageString)
 }
 
+// printSubcommandUsage() prints the usage of a subcommand, such as: flattablesc csv
+func printSubcommandUsage(usageSlice []string) {
+	var usageString string
+	for i := 0; i < len(usageSlice); i++ {
+		usageString += usageSlice[i] + "\n"
+	}
+
+	usageString = strings.Replace(usageString, "${globalUtilName}", globalUtilName, -1)
+
+	fmt.Fprintf(os.Stderr, "%s\n", usageString)
+}
+
 func main() {
 
 	if strings.Contains(os.Args[0], globalUtilName) {
@@ -318,6 +356,24 @@ func main() {
 		os.Exit(2)
 	}
 
+	// Subcommands.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "csv":
+			csvCommand(os.Args[2:])
+			return
+		case "sign":
+			signCommand(os.Args[2:])
+			return
+		case "verify":
+			verifyCommand(os.Args[2:])
+			return
+		case "dump":
+			dumpCommand(os.Args[2:])
+			return
+		}
+	}
+
 	if len(os.Args) == 1 {
 		// No args.
 		fmt.Fprintf(os.Stderr, "%s expects at least 1 argument\n", globalUtilName)
@@ -424,6 +480,19 @@ func main() {
 
 	tablesTemplateInfo.OutDirAbsolute = globalOutDirAbsolute
 	tablesTemplateInfo.OutDirMainAbsolute = globalOutDirMainAbsolute
+	tablesTemplateInfo.SingleLayout = flags.l == flattables.SingleLayout
+	if tablesTemplateInfo.SingleLayout {
+		for _, table := range tablesTemplateInfo.Tables {
+			if table.Codec != "" {
+				fmt.Fprintf(os.Stderr, "%s [%s]: compression needs -l %s\n", flattables.CompressAnnotation, table.TableName, flattables.NestedLayout)
+				os.Exit(23)
+			}
+			if table.Checksum {
+				fmt.Fprintf(os.Stderr, "%s [%s]: checksums need -l %s\n", flattables.ChecksumAnnotation, table.TableName, flattables.NestedLayout)
+				os.Exit(23)
+			}
+		}
+	}
 
 	//	spew.Dump(tablesTemplateInfo)
 
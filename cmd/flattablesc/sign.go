@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urban-wombat/flattables"
+)
+
+/*
+	Subcommands sign and verify sign a FlatTables FlatBuffers binary file into a signed envelope,
+	and verify a signed envelope, with HMAC-SHA256 or Ed25519. See flattables.SignFlatBuffers().
+
+	The envelopes are those of the generated SignAndEncode() and SignFlatBuffers(), so a file signed here
+	can be read with the generated VerifyAndDecode(), and the other way round.
+*/
+
+var signUsageSlice []string = []string{
+	"usage:       ${globalUtilName} sign -a <algorithm> -k <key-file> -i <in-file> -o <out-file>",
+	"purpose:     Sign a FlatTables FlatBuffers binary file: write it with a signature appended (a signed envelope).",
+	"flags:   -a  <algorithm> hmac (HMAC-SHA256 with a shared secret) or ed25519 (Ed25519 with a private key).",
+	"         -k  <key-file> hmac: the secret, at least 32 bytes.",
+	"                        ed25519: the private key (64 bytes) or its seed (32 bytes).",
+	"         -i  <in-file> FlatTables FlatBuffers binary file to sign.",
+	"         -o  <out-file> signed envelope to write.",
+	"        [-v] Verbose",
+}
+
+var verifyUsageSlice []string = []string{
+	"usage:       ${globalUtilName} verify -a <algorithm> -k <key-file> -i <in-file> [-o <out-file>]",
+	"purpose:     Verify the signature of a signed envelope written by ${globalUtilName} sign or the generated SignAndEncode().",
+	"             Exits non-zero if the file is unsigned, or has been tampered with.",
+	"flags:   -a  <algorithm> hmac or ed25519, as signed.",
+	"         -k  <key-file> hmac: the secret, as signed.",
+	"                        ed25519: the public key (32 bytes), or the private key (64 bytes).",
+	"         -i  <in-file> signed envelope to verify.",
+	"        [-o] <out-file> to write the FlatTables FlatBuffers signed, without the signature.",
+	"        [-v] Verbose",
+}
+
+func signCommand(args []string) {
+	const signing = true
+	key, inFile, outFile, verbose := signingFlags(args, "sign", signUsageSlice, signing)
+	if outFile == "" {
+		fmt.Fprintf(os.Stderr, "compulsory flags: -a -k -i -o\n")
+		printSubcommandUsage(signUsageSlice)
+		os.Exit(2)
+	}
+
+	flatBuffers, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(14)
+	}
+
+	envelope, err := flattables.SignFlatBuffers(flatBuffers, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", inFile, err)
+		os.Exit(25)
+	}
+
+	if verbose {
+		fmt.Printf("Writing %d bytes (%d signed) to: %s\n", len(envelope), len(flatBuffers), outFile)
+	}
+	err = ioutil.WriteFile(outFile, envelope, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(20)
+	}
+}
+
+func verifyCommand(args []string) {
+	const signing = false
+	key, inFile, outFile, verbose := signingFlags(args, "verify", verifyUsageSlice, signing)
+
+	envelope, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(14)
+	}
+
+	flatBuffers, err := flattables.VerifySignedFlatBuffers(envelope, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", inFile, err)
+		os.Exit(25)
+	}
+
+	if verbose {
+		fmt.Printf("Verified %d bytes signed in: %s\n", len(flatBuffers), inFile)
+	}
+	if outFile != "" {
+		err = ioutil.WriteFile(outFile, flatBuffers, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(20)
+		}
+	}
+}
+
+// signingFlags() parses the flags of subcommand sign or verify, and reads the key.
+func signingFlags(args []string, subcommand string, usageSlice []string, signing bool) (key flattables.SigningKey, inFile string, outFile string, verbose bool) {
+	var a string // <algorithm>
+	var k string // <key-file>
+
+	flagSet := flag.NewFlagSet(globalUtilName+" "+subcommand, flag.ExitOnError)
+	flagSet.Usage = func() { printSubcommandUsage(usageSlice) }
+	flagSet.StringVar(&a, "a", "", fmt.Sprintf("<algorithm> %s or %s", flattables.SignatureHMAC, flattables.SignatureEd25519))
+	flagSet.StringVar(&k, "k", "", "<key-file> of the secret or key")
+	flagSet.StringVar(&inFile, "i", "", "<in-file> to "+subcommand)
+	flagSet.StringVar(&outFile, "o", "", "<out-file> to write")
+	flagSet.BoolVar(&verbose, "v", false, "verbose")
+	_ = flagSet.Parse(args)
+
+	if a == "" || k == "" || inFile == "" {
+		fmt.Fprintf(os.Stderr, "compulsory flags: -a -k -i\n")
+		printSubcommandUsage(usageSlice)
+		os.Exit(2)
+	}
+
+	keyBytes, err := ioutil.ReadFile(k)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(14)
+	}
+
+	key, err = signingKey(a, keyBytes, signing)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", k, err)
+		os.Exit(24)
+	}
+
+	return key, inFile, outFile, verbose
+}
+
+// signingKey() returns the SigningKey of algorithm from the contents of a key file. An Ed25519 key of 32 bytes
+// is the seed of the private key when signing, and the public key when verifying.
+func signingKey(algorithm string, keyBytes []byte, signing bool) (flattables.SigningKey, error) {
+	switch algorithm {
+	case flattables.SignatureHMAC:
+		return flattables.NewHMACKey(keyBytes)
+	case flattables.SignatureEd25519:
+		switch {
+		case len(keyBytes) == ed25519.SeedSize && signing:
+			return flattables.NewEd25519SigningKey(ed25519.NewKeyFromSeed(keyBytes))
+		case len(keyBytes) == ed25519.PublicKeySize && !signing:
+			return flattables.NewEd25519VerifyingKey(ed25519.PublicKey(keyBytes))
+		default:
+			return flattables.NewEd25519SigningKey(ed25519.PrivateKey(keyBytes))
+		}
+	default:
+		return flattables.SigningKey{}, fmt.Errorf("invalid <algorithm> -a %q (expecting %s or %s)",
+			algorithm, flattables.SignatureHMAC, flattables.SignatureEd25519)
+	}
+}
@@ -0,0 +1,249 @@
+package flattables
+
+// Reading CSV files into gotables tables, for flattablesc csv.
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/urban-wombat/gotables"
+	"github.com/urban-wombat/util"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+The CSV format is the one written by the generated Write<TableName>CSV() functions:-
+
+	A header row of col names, then a row per table row.
+	The cols may be in any order, but every col of the table must be present (and no others).
+	Cells are parsed according to the col type: strconv.ParseBool() for bool, base 10 for integers.
+*/
+
+/*
+NewTableSetFromCSVDir() reads file <dir>/<TableName>.csv for each table in schema, and returns a copy of
+schema with the rows of the CSV files (in place of any rows in schema). Tables with no cols are skipped.
+
+schema is typically a gotables file read with gotables.NewTableSetFromFile(), such as the one given to flattablesc.
+*/
+func NewTableSetFromCSVDir(schema *gotables.TableSet, dir string) (*gotables.TableSet, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("%s(): schema *gotables.TableSet is <nil>", util.FuncName())
+	}
+
+	const copyRows = false
+	tableSet, err := schema.Copy(copyRows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = DeleteEmptyTables(tableSet)
+	if err != nil {
+		return nil, err
+	}
+
+	for tableIndex := 0; tableIndex < tableSet.TableCount(); tableIndex++ {
+		table, err := tableSet.TableByTableIndex(tableIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		var fileName string = filepath.Join(dir, table.Name()+".csv")
+		file, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		err = AppendRowsFromCSV(table, file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+	}
+
+	return tableSet, nil
+}
+
+/*
+NewFlatBuffersFromCSVDir() reads a CSV file per table (see NewTableSetFromCSVDir()) and returns
+the tables as FlatTables FlatBuffers in layout NestedLayout or SingleLayout.
+
+The FlatBuffers are exactly those that NewFlatBuffersFromTableSet() generated by flattablesc
+from schema (with -l layout) would return, with the rows of tables with key cols in key order,
+and the secondary indexes, dictionary-encoded cols, encoded cols, and compressed and checksummed tables declared in schema.
+So they can be read by the generated package.
+*/
+func NewFlatBuffersFromCSVDir(schema *gotables.TableSet, dir string, layout string) (flatBuffers []byte, err error) {
+	tableSet, err := NewTableSetFromCSVDir(schema, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Key cols, indexed cols, dictionary-encoded cols, encoded cols, compressed and checksummed tables, and metadata
+	// declared in the gotables file. See KeyAnnotation, IndexAnnotation, DictAnnotation, EncodeAnnotation,
+	// CompressAnnotation, ChecksumAnnotation and MetadataAnnotation.
+	annotations, err := annotationsFromFile(schema.FileName())
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeTableSet(tableSet, layout, annotations.keys, annotations.indexes, annotations.dicts, annotations.encodings,
+		annotations.codecs, annotations.checksums, annotations.metadata)
+}
+
+// AppendRowsFromCSV() appends a row to table for each row of CSV read from reader, after its header row of col names.
+func AppendRowsFromCSV(table *gotables.Table, reader io.Reader) error {
+	csvReader := csv.NewReader(reader)
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return fmt.Errorf("[%s] CSV has no header row of col names", table.Name())
+	}
+	if err != nil {
+		return err
+	}
+
+	// The col index and type of each CSV field.
+	var colIndexes []int = make([]int, len(header))
+	var colTypes []string = make([]string, len(header))
+	var colFound []bool = make([]bool, table.ColCount())
+	for fieldIndex, colName := range header {
+		hasCol, err := table.HasCol(colName)
+		if err != nil {
+			return err
+		}
+		if !hasCol {
+			return fmt.Errorf("[%s] CSV header has col %q not in table", table.Name(), colName)
+		}
+
+		colIndexes[fieldIndex], err = table.ColIndex(colName)
+		if err != nil {
+			return err
+		}
+		if colFound[colIndexes[fieldIndex]] {
+			return fmt.Errorf("[%s] CSV header has col %q more than once", table.Name(), colName)
+		}
+		colFound[colIndexes[fieldIndex]] = true
+
+		colTypes[fieldIndex], err = table.ColTypeByColIndex(colIndexes[fieldIndex])
+		if err != nil {
+			return err
+		}
+	}
+	for colIndex := 0; colIndex < table.ColCount(); colIndex++ {
+		if !colFound[colIndex] {
+			colName, err := table.ColName(colIndex)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("[%s] CSV header is missing col %q", table.Name(), colName)
+		}
+	}
+
+	// csv.Reader checks that every row has as many fields as the header row.
+	for csvRowIndex := 1; ; csvRowIndex++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = table.AppendRow()
+		if err != nil {
+			return err
+		}
+		var rowIndex int = table.RowCount() - 1
+
+		for fieldIndex, field := range record {
+			err = setCellFromCSV(table, colIndexes[fieldIndex], colTypes[fieldIndex], rowIndex, field)
+			if err != nil {
+				return fmt.Errorf("[%s] CSV row %d col %q: %v", table.Name(), csvRowIndex, header[fieldIndex], err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// setCellFromCSV() parses field as colType and sets the cell at colIndex, rowIndex.
+func setCellFromCSV(table *gotables.Table, colIndex int, colType string, rowIndex int, field string) error {
+	switch colType {
+	case "string":
+		return table.SetStringByColIndex(colIndex, rowIndex, field)
+	case "bool":
+		val, err := strconv.ParseBool(field)
+		if err != nil {
+			return err
+		}
+		return table.SetBoolByColIndex(colIndex, rowIndex, val)
+	case "int8", "int16", "int32", "int64":
+		val, err := strconv.ParseInt(field, 10, flatBuffersElementSizes[colType]*8)
+		if err != nil {
+			return err
+		}
+		switch colType {
+		case "int8":
+			return table.SetInt8ByColIndex(colIndex, rowIndex, int8(val))
+		case "int16":
+			return table.SetInt16ByColIndex(colIndex, rowIndex, int16(val))
+		case "int32":
+			return table.SetInt32ByColIndex(colIndex, rowIndex, int32(val))
+		default:
+			return table.SetInt64ByColIndex(colIndex, rowIndex, val)
+		}
+	case "byte", "uint8", "uint16", "uint32", "uint64":
+		val, err := strconv.ParseUint(field, 10, flatBuffersElementSizes[colType]*8)
+		if err != nil {
+			return err
+		}
+		switch colType {
+		case "byte":
+			return table.SetByteByColIndex(colIndex, rowIndex, byte(val))
+		case "uint8":
+			return table.SetUint8ByColIndex(colIndex, rowIndex, uint8(val))
+		case "uint16":
+			return table.SetUint16ByColIndex(colIndex, rowIndex, uint16(val))
+		case "uint32":
+			return table.SetUint32ByColIndex(colIndex, rowIndex, uint32(val))
+		default:
+			return table.SetUint64ByColIndex(colIndex, rowIndex, val)
+		}
+	case "float32", "float64":
+		val, err := strconv.ParseFloat(field, flatBuffersElementSizes[colType]*8)
+		if err != nil {
+			return err
+		}
+		if colType == "float32" {
+			return table.SetFloat32ByColIndex(colIndex, rowIndex, float32(val))
+		}
+		return table.SetFloat64ByColIndex(colIndex, rowIndex, val)
+	default:
+		return fmt.Errorf("unsupported FlatTables col type: %s", colType)
+	}
+}
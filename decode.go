@@ -0,0 +1,636 @@
+package flattables
+
+// Decoding of FlatTables FlatBuffers as a gotables.TableSet at runtime, without generated code.
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/urban-wombat/gotables"
+	"github.com/urban-wombat/util"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// The largest ratio of uncompressed to compressed size that deflate can reach, as the generated decoders allow it.
+const maxCompressionRatio = 1032
+
+/*
+CorruptTableError is returned by Decode() when the stored bytes of a checksummed table don't match the checksum
+recorded in FlatTables (see ChecksumAnnotation). It has the message of the CorruptTableError of the generated package.
+*/
+type CorruptTableError struct {
+	TableName string
+	Checksum  uint32 // As recorded in FlatTables.
+	Computed  uint32 // Of the stored bytes.
+}
+
+func (err *CorruptTableError) Error() string {
+	return fmt.Sprintf("corrupt FlatTables buffer: table [%s] has checksum %08x, expecting %08x",
+		err.TableName, err.Computed, err.Checksum)
+}
+
+/*
+Decode() returns the tables of FlatTables FlatBuffers in layout NestedLayout (the default of flattablesc),
+without generated code. See DecodeLayout().
+*/
+func Decode(flatBuffers []byte, schema *gotables.TableSet) (tableSet *gotables.TableSet, err error) {
+	return DecodeLayout(flatBuffers, schema, NestedLayout)
+}
+
+/*
+DecodeLayout() returns the tables of FlatTables FlatBuffers in layout NestedLayout or SingleLayout, without generated code.
+
+schema is the gotables file flatBuffers were encoded from (such as read with gotables.NewTableSetFromFile()):
+its tables and cols, and the annotations of schema.FileName(), say where each table and col is in flatBuffers.
+A schema with no file name (such as returned by MetadataFromFlatBuffers()) takes the annotations that flatBuffers
+embed with their metadata (see MetadataAnnotation), if any.
+The rows of schema are ignored. The tables returned are those of NewTableSetFromFlatBuffers() generated
+by flattablesc (with -l layout) from the same file: the tables of schema with cols, with the rows of flatBuffers
+in the order they are stored. So DecodeLayout() reads what EncodeLayout() or the generated encoders write.
+
+Compressed tables are decompressed, and checksummed tables are checked, returning a *CorruptTableError if they don't match.
+flatBuffers may come from an untrusted source: out-of-range offsets return a corrupt FlatTables buffer error.
+*/
+func DecodeLayout(flatBuffers []byte, schema *gotables.TableSet, layout string) (tableSet *gotables.TableSet, err error) {
+	if schema == nil {
+		return nil, fmt.Errorf("%s(): schema *gotables.TableSet is <nil>", util.FuncName())
+	}
+	if len(flatBuffers) < flatbuffers.SizeUOffsetT {
+		return nil, fmt.Errorf("%s(): corrupt FlatTables buffer: len(flatBuffers) = %d", util.FuncName(), len(flatBuffers))
+	}
+
+	switch layout {
+	case NestedLayout, SingleLayout:
+	default:
+		return nil, fmt.Errorf("%s(): invalid layout %q (expecting %s or %s)", util.FuncName(), layout, NestedLayout, SingleLayout)
+	}
+
+	annotations, err := annotationsFromFile(schema.FileName())
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %v", util.FuncName(), err)
+	}
+	if schema.FileName() == "" {
+		metadata, err := embeddedMetadataOf(flatBuffers)
+		if err == nil {
+			annotations, err = annotationsFromText(metadata)
+			if err != nil {
+				return nil, fmt.Errorf("%s(): %s: %v", util.FuncName(), metadataField, err)
+			}
+		}
+	}
+	if layout == SingleLayout && len(annotations.codecs) > 0 {
+		return nil, fmt.Errorf("%s(): %s needs layout %s", util.FuncName(), CompressAnnotation, NestedLayout)
+	}
+	if layout == SingleLayout && len(annotations.checksums) > 0 {
+		return nil, fmt.Errorf("%s(): %s needs layout %s", util.FuncName(), ChecksumAnnotation, NestedLayout)
+	}
+
+	// Reads of the vectors are bounded by the capacity of flatBuffers, not its length (which may
+	// be a truncated slice of a larger buffer). Cap the capacity so that they can't read beyond the end.
+	flatBuffers = flatBuffers[:len(flatBuffers):len(flatBuffers)]
+
+	// The flatbuffers.Table accessors panic on out-of-range offsets. Report a panic as a corrupt buffer.
+	var funcName string = util.FuncName()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			tableSet = nil
+			err = fmt.Errorf("%s(): corrupt FlatTables buffer: %v", funcName, recovered)
+		}
+	}()
+
+	tableSet, err = decodeTableSet(flatBuffers, schema, layout, annotations)
+	if err != nil {
+		if _, isCorrupt := err.(*CorruptTableError); isCorrupt {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s(): %v", util.FuncName(), err)
+	}
+
+	return tableSet, nil
+}
+
+/*
+decodeTableSet() returns the tables of flatBuffers in layout, read with the tables and cols of schema and annotations.
+
+Table i is field i of root table FlatTables, and its other fields are at tableSlot(). A table missing from FlatTables
+was appended to the gotables file after flatBuffers were encoded: it has no rows.
+*/
+func decodeTableSet(flatBuffers []byte, schema *gotables.TableSet, layout string, annotations fileAnnotations) (*gotables.TableSet, error) {
+	const copyRows = false // i.e., don't copy rows.
+	tableSet, err := schema.Copy(copyRows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tables with no cols are not in FlatTables. See DeleteEmptyTables()
+	for tableIndex := tableSet.TableCount() - 1; tableIndex >= 0; tableIndex-- {
+		table, err := tableSet.TableByTableIndex(tableIndex)
+		if err != nil {
+			return nil, err
+		}
+		if table.ColCount() == 0 {
+			err = tableSet.DeleteTableByTableIndex(tableIndex)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var tableCount int = tableSet.TableCount()
+	flatTables := &flatbuffers.Table{Bytes: flatBuffers, Pos: flatbuffers.GetUOffsetT(flatBuffers)}
+
+	for tableIndex := 0; tableIndex < tableCount; tableIndex++ {
+		table, err := tableSet.TableByTableIndex(tableIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		offset := flatbuffers.UOffsetT(flatTables.Offset(fieldOffset(tableIndex)))
+		if offset == 0 {
+			continue
+		}
+
+		var flatTable *flatbuffers.Table
+		if layout == SingleLayout {
+			// A direct child table of FlatTables.
+			flatTable = &flatbuffers.Table{Bytes: flatBuffers, Pos: flatTables.Indirect(flatTables.Pos + offset)}
+		} else {
+			// A nested_flatbuffer.
+			var tableBytes []byte = flatTables.ByteVector(flatTables.Pos + offset)
+			if annotations.checksums[table.Name()] {
+				var checksum uint32 = flatTables.GetUint32Slot(fieldOffset(tableSlot(tableCount, tableIndex, tableChecksumField)), 0)
+				if checksum != 0 { // Zero if encoded before the table was checksummed.
+					computed := crc32.Checksum(tableBytes, castagnoliTable)
+					if computed != checksum {
+						return nil, &CorruptTableError{TableName: table.Name(), Checksum: checksum, Computed: computed}
+					}
+				}
+			}
+			if _, isCompressed := annotations.codecs[table.Name()]; isCompressed {
+				var codec byte = flatTables.GetByteSlot(fieldOffset(tableSlot(tableCount, tableIndex, tableCodecField)), 0)
+				var size uint64 = flatTables.GetUint64Slot(fieldOffset(tableSlot(tableCount, tableIndex, tableSizeField)), 0)
+				tableBytes, err = decompressTableBytes(codec, size, tableBytes)
+				if err != nil {
+					return nil, fmt.Errorf("table [%s]: %v", table.Name(), err)
+				}
+			}
+			tableBytes = tableBytes[:len(tableBytes):len(tableBytes)]
+			flatTable = &flatbuffers.Table{Bytes: tableBytes, Pos: flatbuffers.GetUOffsetT(tableBytes)}
+		}
+
+		err = decodeTable(flatTable, table, annotations.dicts[table.Name()], annotations.encodings[table.Name()])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tableSet, nil
+}
+
+// fieldOffset() returns the vtable offset of field slot of a FlatBuffers table.
+func fieldOffset(slot int) flatbuffers.VOffsetT {
+	return flatbuffers.VOffsetT(flatbuffers.VtableMetadataFields+slot) * flatbuffers.SizeVOffsetT
+}
+
+/*
+decompressTableBytes() returns the nested FlatBuffers bytes of a table stored with codec (a value of codecValues,
+or zero if uncompressed) and size bytes uncompressed, exactly as the generated decoders decompress them.
+*/
+func decompressTableBytes(codec byte, size uint64, storedBytes []byte) (tableBytes []byte, err error) {
+	if codec == 0 {
+		return storedBytes, nil
+	}
+	if size > uint64(len(storedBytes))*maxCompressionRatio {
+		return nil, fmt.Errorf("uncompressed size %d is too large for %d compressed bytes", size, len(storedBytes))
+	}
+
+	var reader io.Reader
+	switch codec {
+	case codecValues[CodecFlate]:
+		reader = flate.NewReader(bytes.NewReader(storedBytes))
+	case codecValues[CodecGzip]:
+		reader, err = gzip.NewReader(bytes.NewReader(storedBytes))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown codec %d", codec)
+	}
+
+	tableBytes = make([]byte, size)
+	_, err = io.ReadFull(reader, tableBytes)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing %d bytes: %v", size, err)
+	}
+
+	// There should be nothing more. (A gzip reader also checks its checksum at the end.)
+	extra, err := io.CopyN(ioutil.Discard, reader, 1)
+	if extra != 0 {
+		return nil, fmt.Errorf("decompressed bytes are longer than uncompressed size %d", size)
+	}
+	if err != io.EOF {
+		return nil, fmt.Errorf("decompressing %d bytes: %v", size, err)
+	}
+
+	return tableBytes, nil
+}
+
+/*
+decodeTable() appends the rows of FlatBuffers table flatTable to table, which has no rows.
+
+flatTable has the fields that buildTable() builds: a vector field for each col, then the fields of each col
+(see colSlot()). A missing vector is empty. Every col must have the same number of rows.
+*/
+func decodeTable(flatTable *flatbuffers.Table, table *gotables.Table, dictColNames []string, encodings map[string]string) error {
+	// Run-length encoded cols are decoded last, so that their run ends can't be beyond the rows of the other cols.
+	var colIndexes []int = make([]int, 0, table.ColCount())
+	var runLengthColIndexes []int
+	for colIndex := 0; colIndex < table.ColCount(); colIndex++ {
+		colName, err := table.ColNameByColIndex(colIndex)
+		if err != nil {
+			return err
+		}
+		colType, err := table.ColTypeByColIndex(colIndex)
+		if err != nil {
+			return err
+		}
+		if _, exists := flatBuffersElementSizes[colType]; !exists {
+			return fmt.Errorf("[%s] col %s: unsupported FlatTables col type: %s", table.Name(), colName, colType)
+		}
+
+		if encodings[colName] == EncodingRunLength {
+			runLengthColIndexes = append(runLengthColIndexes, colIndex)
+		} else {
+			colIndexes = append(colIndexes, colIndex)
+		}
+	}
+	colIndexes = append(colIndexes, runLengthColIndexes...)
+
+	const noRowLimit = -1
+	var rowLimit int = noRowLimit
+	for _, colIndex := range colIndexes {
+		colName, err := table.ColNameByColIndex(colIndex)
+		if err != nil {
+			return err
+		}
+		colType, err := table.ColTypeByColIndex(colIndex)
+		if err != nil {
+			return err
+		}
+
+		var isDict bool
+		for _, dictColName := range dictColNames {
+			if dictColName == colName {
+				isDict = true
+			}
+		}
+		encoding, isEncoded := encodings[colName]
+
+		var vals []interface{}
+		switch {
+		case isDict:
+			vals, err = decodeDictCol(flatTable, colIndex, colSlot(colIndex, colCodesField))
+		case isEncoded:
+			vals, err = decodeEncodedCol(flatTable, colType, colIndex, colSlot(colIndex, 0), encoding, rowLimit)
+		default:
+			vals, err = decodeColVector(flatTable, colType, colIndex)
+		}
+		if err != nil {
+			return fmt.Errorf("[%s] col %s: %v", table.Name(), colName, err)
+		}
+
+		if rowLimit == noRowLimit {
+			err = table.AppendRows(len(vals))
+			if err != nil {
+				return err
+			}
+			rowLimit = len(vals)
+		} else if len(vals) != table.RowCount() {
+			return fmt.Errorf("[%s] col %s has %d rows, expecting %d", table.Name(), colName, len(vals), table.RowCount())
+		}
+
+		for rowIndex, val := range vals {
+			err = table.SetValByColIndex(colIndex, rowIndex, val)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+vectorField() returns the position of the first element of vector field slot of flatTable, of elements of elementSize bytes,
+and its length. A missing vector has length 0. A vector that doesn't fit in the bytes of flatTable is an error.
+*/
+func vectorField(flatTable *flatbuffers.Table, slot int, elementSize int) (start flatbuffers.UOffsetT, length int, exists bool, err error) {
+	offset := flatbuffers.UOffsetT(flatTable.Offset(fieldOffset(slot)))
+	if offset == 0 {
+		return 0, 0, false, nil
+	}
+
+	start, length = flatTable.Vector(offset), flatTable.VectorLen(offset)
+	if uint64(start)+uint64(length)*uint64(elementSize) > uint64(len(flatTable.Bytes)) {
+		return 0, 0, false, fmt.Errorf("vector of %d elements at %d is out of range of %d bytes", length, start, len(flatTable.Bytes))
+	}
+
+	return start, length, true, nil
+}
+
+// decodeColVector() returns the cells of the vector of col colIndex of colType.
+func decodeColVector(flatTable *flatbuffers.Table, colType string, colIndex int) (vals []interface{}, err error) {
+	start, length, _, err := vectorField(flatTable, colIndex, flatBuffersElementSizes[colType])
+	if err != nil {
+		return nil, err
+	}
+	var elementSize flatbuffers.UOffsetT = flatbuffers.UOffsetT(flatBuffersElementSizes[colType])
+	vals = make([]interface{}, length)
+	for rowIndex := 0; rowIndex < length; rowIndex++ {
+		vals[rowIndex] = decodeCell(flatTable, colType, start+flatbuffers.UOffsetT(rowIndex)*elementSize)
+	}
+
+	return vals, nil
+}
+
+// decodeCell() returns the cell of colType at position pos of flatTable, as gotables holds it.
+func decodeCell(flatTable *flatbuffers.Table, colType string, pos flatbuffers.UOffsetT) interface{} {
+	switch colType {
+	case "bool":
+		// FlatBuffers stores bool as a byte, which is true if it is not 0.
+		return flatTable.GetByte(pos) != 0
+	case "int8":
+		return flatTable.GetInt8(pos)
+	case "int16":
+		return flatTable.GetInt16(pos)
+	case "int32":
+		return flatTable.GetInt32(pos)
+	case "int64":
+		return flatTable.GetInt64(pos)
+	case "byte":
+		return flatTable.GetByte(pos)
+	case "uint8":
+		return flatTable.GetUint8(pos)
+	case "uint16":
+		return flatTable.GetUint16(pos)
+	case "uint32":
+		return flatTable.GetUint32(pos)
+	case "uint64":
+		return flatTable.GetUint64(pos)
+	case "float32":
+		return flatTable.GetFloat32(pos)
+	case "float64":
+		return flatTable.GetFloat64(pos)
+	default: // "string"
+		return string(flatTable.ByteVector(pos))
+	}
+}
+
+/*
+decodeDictCol() returns the cells of dictionary-encoded string col colIndex (see DictAnnotation): the codes of its rows,
+in the first present of the fields codesSlot, codesSlot+1 and codesSlot+2 (of 1, 2 and 4 bytes per code), are indexes
+into the dictionary of distinct values in the vector of the col. With no codes (FlatBuffers encoded before the col was
+dictionary-encoded), the vector of the col is the cells, as the generated accessors read it.
+*/
+func decodeDictCol(flatTable *flatbuffers.Table, colIndex int, codesSlot int) (vals []interface{}, err error) {
+	dictStart, dictLength, _, err := vectorField(flatTable, colIndex, flatbuffers.SizeUOffsetT)
+	if err != nil {
+		return nil, err
+	}
+	var dict []string = make([]string, dictLength)
+	for code := 0; code < dictLength; code++ {
+		dict[code] = string(flatTable.ByteVector(dictStart + flatbuffers.UOffsetT(code*flatbuffers.SizeUOffsetT)))
+	}
+
+	for codeSize, slot := 1, codesSlot; slot < codesSlot+3; codeSize, slot = 2*codeSize, slot+1 {
+		start, length, exists, err := vectorField(flatTable, slot, codeSize)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		vals = make([]interface{}, length)
+		for rowIndex := 0; rowIndex < length; rowIndex++ {
+			var pos flatbuffers.UOffsetT = start + flatbuffers.UOffsetT(rowIndex*codeSize)
+			var code int
+			switch codeSize {
+			case flatbuffers.SizeByte:
+				code = int(flatTable.GetByte(pos))
+			case flatbuffers.SizeUint16:
+				code = int(flatTable.GetUint16(pos))
+			default:
+				code = int(flatTable.GetUint32(pos))
+			}
+			if code >= dictLength {
+				return nil, fmt.Errorf("row %d code %d is out of range of %d dictionary values", rowIndex, code, dictLength)
+			}
+			vals[rowIndex] = dict[code]
+		}
+		return vals, nil
+	}
+
+	// No codes: the dictionary is the cells.
+	vals = make([]interface{}, dictLength)
+	for rowIndex := 0; rowIndex < dictLength; rowIndex++ {
+		vals[rowIndex] = dict[rowIndex]
+	}
+
+	return vals, nil
+}
+
+/*
+decodeEncodedCol() returns the cells of col colIndex of colType encoded with encoding (see EncodeAnnotation).
+The heads are in the vector of the col, and the deltas or run ends in the first present of the encodedFieldCount()
+fields of the col, from its fields at colFieldsSlot (see colSlot()). The values are added modulo the size of the col,
+as the generated iterators add them. Run ends beyond rowLimit rows (if it isn't negative) are an error. With no deltas
+or run ends (FlatBuffers encoded before the col was encoded), the vector of the col is the cells, as the generated
+accessors read it.
+*/
+func decodeEncodedCol(flatTable *flatbuffers.Table, colType string, colIndex int, colFieldsSlot int,
+	encoding string, rowLimit int) (vals []interface{}, err error) {
+	headsStart, headCount, _, err := vectorField(flatTable, colIndex, flatBuffersElementSizes[colType])
+	if err != nil {
+		return nil, err
+	}
+	var elementSize flatbuffers.UOffsetT = flatbuffers.UOffsetT(flatBuffersElementSizes[colType])
+	head := func(headIndex int) (int64, error) {
+		if headIndex >= headCount {
+			return 0, fmt.Errorf("head %d is out of range of %d heads", headIndex, headCount)
+		}
+		return encodedVal(decodeCell(flatTable, colType, headsStart+flatbuffers.UOffsetT(headIndex)*elementSize))
+	}
+
+	var fieldCount int = encodedFieldCount(colType, encoding)
+	for fieldIndex := 0; fieldIndex < fieldCount; fieldIndex++ {
+		var entryBits int = 8 << uint(fieldIndex)
+		if encoding == EncodingRunLength {
+			entryBits = 32
+		}
+		start, length, exists, err := vectorField(flatTable, colFieldsSlot+encodedColField(encoding, entryBits), entryBits/8)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		var values []int64
+		if encoding == EncodingRunLength {
+			values, err = decodeRunLength(flatTable, start, length, rowLimit, head)
+		} else {
+			values, err = decodeDelta(flatTable, start, length, entryBits, encoding == EncodingDeltaOfDelta, head)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		vals = make([]interface{}, len(values))
+		for rowIndex, value := range values {
+			vals[rowIndex], err = decodedVal(colType, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return vals, nil
+	}
+
+	// No entries: the heads are the cells.
+	return decodeColVector(flatTable, colType, colIndex)
+}
+
+/*
+decodeRunLength() returns the values of the runs of the length run ends at start: the value of each run is its head.
+Run ends beyond rowLimit rows (if it isn't negative) are an error.
+*/
+func decodeRunLength(flatTable *flatbuffers.Table, start flatbuffers.UOffsetT, length int, rowLimit int,
+	head func(headIndex int) (int64, error)) (values []int64, err error) {
+	var runStart uint32
+	for runIndex := 0; runIndex < length; runIndex++ {
+		var runEnd uint32 = flatTable.GetUint32(start + flatbuffers.UOffsetT(runIndex*flatbuffers.SizeUint32))
+		if runEnd <= runStart {
+			return nil, fmt.Errorf("run %d ends at row %d, after row %d", runIndex, runEnd, runStart)
+		}
+		if rowLimit >= 0 && uint64(runEnd) > uint64(rowLimit) {
+			return nil, fmt.Errorf("run %d ends at row %d, beyond %d rows", runIndex, runEnd, rowLimit)
+		}
+		value, err := head(runIndex)
+		if err != nil {
+			return nil, err
+		}
+		for rowIndex := runStart; rowIndex < runEnd; rowIndex++ {
+			values = append(values, value)
+		}
+		runStart = runEnd
+	}
+
+	return values, nil
+}
+
+/*
+decodeDelta() returns the values of the length entries of entryBits bits at start, delta-encoded (or delta-of-delta
+encoded if ofDelta) in blocks of deltaBlockRows rows. Each block starts at its head, and delta of delta has two heads
+per block: its first value, and the delta from it to the next row. See encodeDelta().
+*/
+func decodeDelta(flatTable *flatbuffers.Table, start flatbuffers.UOffsetT, length int, entryBits int, ofDelta bool,
+	head func(headIndex int) (int64, error)) (values []int64, err error) {
+	values = make([]int64, length)
+	var value, delta int64
+	for rowIndex := 0; rowIndex < length; rowIndex++ {
+		if rowIndex%deltaBlockRows == 0 {
+			var block int = rowIndex / deltaBlockRows
+			if ofDelta {
+				value, err = head(2 * block)
+				if err == nil {
+					delta, err = head(2*block + 1)
+				}
+			} else {
+				value, err = head(block)
+			}
+			if err != nil {
+				return nil, err
+			}
+			values[rowIndex] = value
+			continue
+		}
+
+		var entry int64
+		var pos flatbuffers.UOffsetT = start + flatbuffers.UOffsetT(rowIndex*entryBits/8)
+		switch entryBits {
+		case 8:
+			entry = int64(flatTable.GetInt8(pos))
+		case 16:
+			entry = int64(flatTable.GetInt16(pos))
+		case 32:
+			entry = int64(flatTable.GetInt32(pos))
+		default:
+			entry = flatTable.GetInt64(pos)
+		}
+
+		if ofDelta {
+			delta += entry
+		} else {
+			delta = entry
+		}
+		value += delta
+		values[rowIndex] = value
+	}
+
+	return values, nil
+}
+
+// decodedVal() returns value decoded from an encoded col as a cell of colType. It is the inverse of encodedVal().
+func decodedVal(colType string, value int64) (interface{}, error) {
+	switch colType {
+	case "bool":
+		return value != 0, nil
+	case "int8":
+		return int8(value), nil
+	case "int16":
+		return int16(value), nil
+	case "int32":
+		return int32(value), nil
+	case "int64":
+		return value, nil
+	case "byte":
+		return byte(value), nil
+	case "uint8":
+		return uint8(value), nil
+	case "uint16":
+		return uint16(value), nil
+	case "uint32":
+		return uint32(value), nil
+	case "uint64":
+		return uint64(value), nil
+	default:
+		return nil, fmt.Errorf("encoded col type %s is not an integer or bool", colType)
+	}
+}
@@ -0,0 +1,643 @@
+package flattables
+
+// Encoding of a gotables.TableSet as FlatTables FlatBuffers at runtime, without generated code.
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/urban-wombat/gotables"
+	"github.com/urban-wombat/util"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// The size in bytes of a FlatBuffers vector element of each col type. A string element is an offset.
+var flatBuffersElementSizes = map[string]int{
+	"bool":    1,
+	"int8":    1,
+	"byte":    1,
+	"uint8":   1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"float32": 4,
+	"int64":   8,
+	"uint64":  8,
+	"float64": 8,
+	"string":  flatbuffers.SizeUOffsetT,
+}
+
+/*
+Encode() returns tableSet as FlatTables FlatBuffers in layout NestedLayout (the default of flattablesc),
+without generated code. See EncodeLayout().
+*/
+func Encode(tableSet *gotables.TableSet) (flatBuffers []byte, err error) {
+	return EncodeLayout(tableSet, NestedLayout)
+}
+
+/*
+EncodeLayout() returns tableSet as FlatTables FlatBuffers in layout NestedLayout or SingleLayout, without generated code.
+
+The bytes are exactly those of NewFlatBuffersFromTableSet() generated by flattablesc (with -l layout) from the gotables
+file tableSet was read from (tableSet.FileName()), and can be read by the generated package, or by Decode().
+EncodeLayout() is the reference for the layout: the test generated with the package (TestFlatTablesLibrary) checks
+the generated encoder and decoder against EncodeLayout() and DecodeLayout(), so a template that drifts fails it.
+The annotations of that file apply: rows of tables with key cols are written in key order, and the secondary indexes,
+dictionary-encoded cols, encoded cols, compressed and checksummed tables and metadata are written as declared.
+A tableSet with no file name is written with none of them.
+*/
+func EncodeLayout(tableSet *gotables.TableSet, layout string) (flatBuffers []byte, err error) {
+	if tableSet == nil {
+		return nil, fmt.Errorf("%s(): tableSet *gotables.TableSet is <nil>", util.FuncName())
+	}
+
+	annotations, err := annotationsFromFile(tableSet.FileName())
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %v", util.FuncName(), err)
+	}
+
+	return encodeTableSet(tableSet, layout, annotations.keys, annotations.indexes, annotations.dicts, annotations.encodings,
+		annotations.codecs, annotations.checksums, annotations.metadata)
+}
+
+/*
+encodeTableSet() returns tableSet as FlatTables FlatBuffers in layout NestedLayout or SingleLayout.
+
+The bytes are exactly those of NewFlatBuffersFromTableSet() generated by flattablesc (with -l layout)
+from a gotables file with the same tables and cols as tableSet, including the stats table of each table.
+Tables with no cols are skipped, as they are by flattablesc.
+
+keys has the key col names of each table with key cols (see KeyAnnotation). Their rows are written in key order.
+indexes has the indexed col names of each table with secondary indexes (see IndexAnnotation).
+dicts has the dictionary-encoded col names of each table with dictionary-encoded cols (see DictAnnotation).
+encodings has the encoding of each encoded col of each table with encoded cols (see EncodeAnnotation).
+codecs has the codec of each compressed table (see CompressAnnotation), which needs layout NestedLayout.
+checksums has the names of the checksummed tables (see ChecksumAnnotation), which need layout NestedLayout.
+metadata embeds the metadata of the tables in FlatTables (see MetadataAnnotation).
+*/
+func encodeTableSet(tableSet *gotables.TableSet, layout string, keys map[string][]string, indexes map[string][]string,
+	dicts map[string][]string, encodings map[string]map[string]string, codecs map[string]string,
+	checksums map[string]bool, metadata bool) (flatBuffers []byte, err error) {
+	if tableSet == nil {
+		return nil, fmt.Errorf("%s(): tableSet *gotables.TableSet is <nil>", util.FuncName())
+	}
+
+	switch layout {
+	case NestedLayout, SingleLayout:
+	default:
+		return nil, fmt.Errorf("%s(): invalid layout %q (expecting %s or %s)", util.FuncName(), layout, NestedLayout, SingleLayout)
+	}
+	if layout == SingleLayout && len(codecs) > 0 {
+		return nil, fmt.Errorf("%s(): %s needs layout %s", util.FuncName(), CompressAnnotation, NestedLayout)
+	}
+	if layout == SingleLayout && len(checksums) > 0 {
+		return nil, fmt.Errorf("%s(): %s needs layout %s", util.FuncName(), ChecksumAnnotation, NestedLayout)
+	}
+
+	const initialSize = 0
+	builder := flatbuffers.NewBuilder(initialSize)
+
+	var offsets []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, 0, tableSet.TableCount())
+	var statsTables []*gotables.Table = make([]*gotables.Table, 0, tableSet.TableCount())
+	// Of each table. Zero if it isn't compressed or checksummed: a zero field is not written.
+	var compressedTables []compressedTable = make([]compressedTable, 0, tableSet.TableCount())
+	var tableChecksums []uint32 = make([]uint32, 0, tableSet.TableCount())
+	for tableIndex := 0; tableIndex < tableSet.TableCount(); tableIndex++ {
+		table, err := tableSet.TableByTableIndex(tableIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		if table.ColCount() == 0 {
+			continue // See DeleteEmptyTables()
+		}
+
+		rowIndexes, err := sortedRowIndexes(table, keys[table.Name()])
+		if err != nil {
+			return nil, err
+		}
+
+		var offset flatbuffers.UOffsetT
+		if layout == SingleLayout {
+			// A direct child table of FlatTables.
+			offset, err = buildTable(builder, table, rowIndexes, indexes[table.Name()], dicts[table.Name()], encodings[table.Name()])
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// A nested_flatbuffer, finished in a builder of its own.
+			builderLocal := flatbuffers.NewBuilder(initialSize)
+			offset, err = buildTable(builderLocal, table, rowIndexes, indexes[table.Name()], dicts[table.Name()], encodings[table.Name()])
+			if err != nil {
+				return nil, err
+			}
+			builderLocal.Finish(offset)
+			var tableBytes []byte = builderLocal.FinishedBytes()
+			var compressed compressedTable
+			if codec, isCompressed := codecs[table.Name()]; isCompressed {
+				compressed = compressedTable{codec: codecValues[codec], size: uint64(len(tableBytes))}
+				tableBytes, err = compressTableBytes(codec, tableBytes)
+				if err != nil {
+					return nil, fmt.Errorf("%s(): table [%s]: %v", util.FuncName(), table.Name(), err)
+				}
+			}
+			var checksum uint32
+			if checksums[table.Name()] {
+				checksum = crc32.Checksum(tableBytes, castagnoliTable)
+			}
+			compressedTables = append(compressedTables, compressed)
+			tableChecksums = append(tableChecksums, checksum)
+			offset = builder.CreateByteVector(tableBytes)
+		}
+		offsets = append(offsets, offset)
+		statsTables = append(statsTables, table)
+	}
+
+	// The stats tables are built after all the tables, as buildFlatTables() builds them.
+	var statsOffsets []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, len(statsTables))
+	for tableIndex := 0; tableIndex < len(statsTables); tableIndex++ {
+		statsOffsets[tableIndex], err = buildStats(builder, statsTables[tableIndex])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The metadata is built after the stats tables, as buildFlatTables() builds it.
+	var metadataOffset flatbuffers.UOffsetT
+	if metadata {
+		text, err := metadataText(tableSet)
+		if err != nil {
+			return nil, err
+		}
+		annotations := fileAnnotations{keys: keys, indexes: indexes, dicts: dicts, encodings: encodings,
+			codecs: codecs, checksums: checksums, metadata: metadata}
+		metadataOffset = builder.CreateString(embeddedMetadata(annotationLines(annotations), text))
+	}
+
+	// The fields are added in the order the generated encoders add them: the tables, their stats tables,
+	// the codec and size of each compressed table, the checksum of each checksummed table, then the metadata.
+	var tableCount int = len(offsets)
+	builder.StartObject(metadataSlot(tableCount) + 1)
+	for tableIndex := 0; tableIndex < tableCount; tableIndex++ {
+		builder.PrependUOffsetTSlot(tableIndex, offsets[tableIndex], 0)
+	}
+	for tableIndex := 0; tableIndex < len(statsOffsets); tableIndex++ {
+		builder.PrependUOffsetTSlot(tableSlot(tableCount, tableIndex, tableStatsField), statsOffsets[tableIndex], 0)
+	}
+	for tableIndex, compressed := range compressedTables {
+		builder.PrependByteSlot(tableSlot(tableCount, tableIndex, tableCodecField), compressed.codec, 0)
+		builder.PrependUint64Slot(tableSlot(tableCount, tableIndex, tableSizeField), compressed.size, 0)
+	}
+	for tableIndex, checksum := range tableChecksums {
+		builder.PrependUint32Slot(tableSlot(tableCount, tableIndex, tableChecksumField), checksum, 0)
+	}
+	builder.PrependUOffsetTSlot(metadataSlot(tableCount), metadataOffset, 0)
+	builder.Finish(builder.EndObject())
+
+	return builder.FinishedBytes(), nil
+}
+
+/*
+The fields of root table FlatTables, as the schema generated by flattablesc declares them. The first are the tables,
+at slot tableIndex, where FlatBuffers encoded before the other fields were added have them. Then each table has
+tableFieldCount fields, in table order: see tableSlot(). Every table has all of them (those it doesn't use are
+deprecated in the schema), so that declaring a table compressed or checksummed never moves a field. The last field
+is the metadata (see MetadataAnnotation). Appending a table moves the fields after the tables, so FlatBuffers
+encoded with them must be encoded again.
+*/
+const (
+	tableStatsField    = iota // Its stats table.
+	tableCodecField           // Its codec (see CompressAnnotation).
+	tableSizeField            // Its size uncompressed.
+	tableChecksumField        // Its checksum (see ChecksumAnnotation).
+	tableFieldCount
+)
+
+// tableSlot() returns the slot in root table FlatTables of tableCount tables of field tableField of table tableIndex.
+func tableSlot(tableCount int, tableIndex int, tableField int) int {
+	return tableCount + tableFieldCount*tableIndex + tableField
+}
+
+// metadataSlot() returns the slot in root table FlatTables of tableCount tables of its metadata: the last field.
+func metadataSlot(tableCount int) int {
+	return tableSlot(tableCount, tableCount, 0)
+}
+
+// The CRC32-C table of the checksums of ChecksumAnnotation, as the generated code computes them.
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// compressedTable is the codec and uncompressed size of a compressed table, as FlatTables records them.
+type compressedTable struct {
+	codec byte
+	size  uint64
+}
+
+/*
+compressTableBytes() returns the nested FlatBuffers bytes of a table compressed with codec (see CompressAnnotation),
+exactly as the generated encoders compress them.
+*/
+func compressTableBytes(codec string, tableBytes []byte) (compressed []byte, err error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch codec {
+	case CodecFlate:
+		writer, err = flate.NewWriter(&buffer, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+	case CodecGzip:
+		writer = gzip.NewWriter(&buffer)
+	default:
+		return nil, fmt.Errorf("unknown codec %q", codec)
+	}
+
+	_, err = writer.Write(tableBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+/*
+The fields of a data table, as the schema generated by flattablesc declares them. The first are the vectors of the cols,
+at slot colIndex. Then, in a table with an indexed, dictionary-encoded or encoded col, each col has colFieldCount fields,
+in col order, from slot colFieldsStartSlot: see colSlot(). Every col has all of them (those it doesn't use are
+deprecated in the schema), so that indexing or encoding a col never moves a field. The slots between the last col
+vector and colFieldsStartSlot are deprecated placeholders, so that appending a col never moves a field either.
+*/
+const (
+	colIndexField   = iota               // Its index (see IndexAnnotation).
+	colCodesField                        // Its dictionary codes of 8, 16 and 32 bits (see DictAnnotation).
+	colDeltasField  = colCodesField + 3  // Its deltas of 8, 16, 32 and 64 bits (see EncodeAnnotation).
+	colRunEndsField = colDeltasField + 4 // Its run ends (see EncodeAnnotation).
+	colFieldCount   = colRunEndsField + 1
+)
+
+// The slot of the first field of the cols of a data table, and so the most cols of a table with col fields.
+const colFieldsStartSlot = 64
+
+// colSlot() returns the slot in a data table of field colField of col colIndex.
+func colSlot(colIndex int, colField int) int {
+	return colFieldsStartSlot + colFieldCount*colIndex + colField
+}
+
+/*
+buildTable() builds table in builder as a FlatBuffers table with a vector field for each col, then the fields
+of each col (see colSlot()): the index of each of indexColNames, the codes of each of dictColNames (see DictAnnotation),
+and the deltas or run ends of each col in encodings (see EncodeAnnotation). It returns its (unfinished) offset.
+Row i of the vectors is row rowIndexes[i] of table.
+*/
+func buildTable(builder *flatbuffers.Builder, table *gotables.Table, rowIndexes []int, indexColNames []string,
+	dictColNames []string, encodings map[string]string) (offset flatbuffers.UOffsetT, err error) {
+	if (len(indexColNames) > 0 || len(dictColNames) > 0 || len(encodings) > 0) && table.ColCount() > colFieldsStartSlot {
+		return 0, fmt.Errorf("[%s] has %d cols: a table with %s, %s or %s has at most %d cols",
+			table.Name(), table.ColCount(), IndexAnnotation, DictAnnotation, EncodeAnnotation, colFieldsStartSlot)
+	}
+
+	// Create the col vectors outside StartObject() to avoid nesting error.
+	var colVectors []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, table.ColCount())
+	var codesVectors []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, len(dictColNames))
+	var codeSizes []int = make([]int, len(dictColNames))
+	var dictColIndexes []int = make([]int, len(dictColNames))
+	var encodedCols []encodedCol
+	for colIndex := 0; colIndex < table.ColCount(); colIndex++ {
+		colName, err := table.ColNameByColIndex(colIndex)
+		if err != nil {
+			return 0, err
+		}
+		var dictIndex int = -1
+		for index, dictColName := range dictColNames {
+			if dictColName == colName {
+				dictIndex = index
+			}
+		}
+		encoding, isEncoded := encodings[colName]
+		if dictIndex >= 0 {
+			dictColIndexes[dictIndex] = colIndex
+			colVectors[colIndex], codesVectors[dictIndex], codeSizes[dictIndex], err = buildDictVectors(builder, table, colIndex, rowIndexes)
+		} else if isEncoded {
+			var encoded encodedCol = encodedCol{colIndex: colIndex, encoding: encoding}
+			colVectors[colIndex], encoded.entriesVector, encoded.entryBits, err = buildEncodedVectors(builder, table, colIndex, rowIndexes, encoding)
+			encodedCols = append(encodedCols, encoded)
+		} else {
+			colVectors[colIndex], err = buildColVector(builder, table, colIndex, rowIndexes)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var indexVectors []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, len(indexColNames))
+	var indexColIndexes []int = make([]int, len(indexColNames))
+	for indexIndex, indexColName := range indexColNames {
+		indexVectors[indexIndex], err = buildIndexVector(builder, table, indexColName, rowIndexes)
+		if err != nil {
+			return 0, err
+		}
+		indexColIndexes[indexIndex], err = table.ColIndex(indexColName)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The fields are added in the order the generated encoders add them: the cols, the indexes, the codes
+	// of the dictionary-encoded cols, then the deltas or run ends of the encoded cols.
+	var colCount int = table.ColCount()
+	builder.StartObject(colSlot(colCount, 0))
+	for colIndex := 0; colIndex < colCount; colIndex++ {
+		builder.PrependUOffsetTSlot(colIndex, colVectors[colIndex], 0)
+	}
+	for indexIndex, colIndex := range indexColIndexes {
+		builder.PrependUOffsetTSlot(colSlot(colIndex, colIndexField), indexVectors[indexIndex], 0)
+	}
+	for dictIndex, colIndex := range dictColIndexes {
+		var slot int = colSlot(colIndex, colCodesField)
+		switch codeSizes[dictIndex] {
+		case flatbuffers.SizeUint16:
+			slot++
+		case flatbuffers.SizeUint32:
+			slot += 2
+		}
+		builder.PrependUOffsetTSlot(slot, codesVectors[dictIndex], 0)
+	}
+	for _, encoded := range encodedCols {
+		builder.PrependUOffsetTSlot(colSlot(encoded.colIndex, encodedColField(encoded.encoding, encoded.entryBits)),
+			encoded.entriesVector, 0)
+	}
+
+	return builder.EndObject(), nil
+}
+
+/*
+buildIndexVector() builds the index of col indexColName of table as a FlatBuffers [uint] vector, and returns its offset.
+The index is the row indexes of the vectors in order of the col, then of row, as the generated code builds it.
+Row i of the vectors is row rowIndexes[i] of table.
+*/
+func buildIndexVector(builder *flatbuffers.Builder, table *gotables.Table, indexColName string, rowIndexes []int) (vector flatbuffers.UOffsetT, err error) {
+	colType, err := table.ColType(indexColName)
+	if err != nil {
+		return 0, err
+	}
+	if _, exists := flatBuffersElementSizes[colType]; !exists {
+		return 0, fmt.Errorf("[%s] index col %s: unsupported FlatTables col type: %s", table.Name(), indexColName, colType)
+	}
+
+	var cells []interface{} = make([]interface{}, len(rowIndexes))
+	var index []uint32 = make([]uint32, len(rowIndexes))
+	for rowIndex := 0; rowIndex < len(rowIndexes); rowIndex++ {
+		cells[rowIndex], err = table.GetVal(indexColName, rowIndexes[rowIndex])
+		if err != nil {
+			return 0, err
+		}
+		index[rowIndex] = uint32(rowIndex)
+	}
+
+	sort.Slice(index, func(i, j int) bool {
+		if comparison := compareVals(cells[index[i]], cells[index[j]]); comparison != 0 {
+			return comparison < 0
+		}
+		return index[i] < index[j] // Rows with equal values stay in row order.
+	})
+
+	builder.StartVector(flatbuffers.SizeUint32, len(index), flatbuffers.SizeUint32)
+	for position := len(index) - 1; position >= 0; position-- {
+		builder.PrependUint32(index[position])
+	}
+
+	return builder.EndVector(len(index)), nil
+}
+
+// encodedCol is the vector of deltas or run ends of an encoded col, as buildTable() adds it.
+type encodedCol struct {
+	colIndex      int
+	encoding      string
+	entriesVector flatbuffers.UOffsetT
+	entryBits     int
+}
+
+/*
+buildDictVectors() builds string col colIndex of table dictionary-encoded (see DictAnnotation), exactly as the generated
+encoders do: a [string] vector of its distinct values in order of first row, and a vector of the code of each row,
+of codeSize bytes. It returns their offsets and codeSize. Row i of the vectors is row rowIndexes[i] of table.
+*/
+func buildDictVectors(builder *flatbuffers.Builder, table *gotables.Table, colIndex int, rowIndexes []int) (dictVector flatbuffers.UOffsetT,
+	codesVector flatbuffers.UOffsetT, codeSize int, err error) {
+	colType, err := table.ColTypeByColIndex(colIndex)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if colType != "string" {
+		return 0, 0, 0, fmt.Errorf("[%s] col %d: dictionary-encoded col type %s is not string", table.Name(), colIndex, colType)
+	}
+
+	var codes map[string]uint32 = make(map[string]uint32)
+	var values []string
+	var rowCodes []uint32 = make([]uint32, len(rowIndexes))
+	for rowIndex := 0; rowIndex < len(rowIndexes); rowIndex++ {
+		cell, err := table.GetStringByColIndex(colIndex, rowIndexes[rowIndex])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		code, exists := codes[cell]
+		if !exists {
+			code = uint32(len(values))
+			codes[cell] = code
+			values = append(values, cell)
+		}
+		rowCodes[rowIndex] = code
+	}
+
+	// Create the strings outside StartVector() to avoid nesting error.
+	var stringOffsets []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, len(values))
+	for code, value := range values {
+		stringOffsets[code] = builder.CreateString(value)
+	}
+	builder.StartVector(flatbuffers.SizeUOffsetT, len(stringOffsets), flatbuffers.SizeUOffsetT)
+	for code := len(stringOffsets) - 1; code >= 0; code-- {
+		builder.PrependUOffsetT(stringOffsets[code])
+	}
+	dictVector = builder.EndVector(len(stringOffsets))
+
+	switch {
+	case len(values) <= 1<<8:
+		codeSize = flatbuffers.SizeByte
+	case len(values) <= 1<<16:
+		codeSize = flatbuffers.SizeUint16
+	default:
+		codeSize = flatbuffers.SizeUint32
+	}
+
+	builder.StartVector(codeSize, len(rowCodes), codeSize)
+	for rowIndex := len(rowCodes) - 1; rowIndex >= 0; rowIndex-- {
+		switch codeSize {
+		case flatbuffers.SizeByte:
+			builder.PrependByte(byte(rowCodes[rowIndex]))
+		case flatbuffers.SizeUint16:
+			builder.PrependUint16(uint16(rowCodes[rowIndex]))
+		default:
+			builder.PrependUint32(rowCodes[rowIndex])
+		}
+	}
+	codesVector = builder.EndVector(len(rowCodes))
+
+	return dictVector, codesVector, codeSize, nil
+}
+
+// buildColVector() builds col colIndex of table as a FlatBuffers vector, and returns its offset.
+func buildColVector(builder *flatbuffers.Builder, table *gotables.Table, colIndex int, rowIndexes []int) (vector flatbuffers.UOffsetT, err error) {
+	colType, err := table.ColTypeByColIndex(colIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	elementSize, exists := flatBuffersElementSizes[colType]
+	if !exists {
+		return 0, fmt.Errorf("[%s] col %d: unsupported FlatTables col type: %s", table.Name(), colIndex, colType)
+	}
+
+	var rowCount int = table.RowCount()
+
+	if colType == "string" {
+		// Create the strings outside StartVector() to avoid nesting error.
+		var stringOffsets []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, rowCount)
+		for rowIndex := 0; rowIndex < rowCount; rowIndex++ {
+			cell, err := table.GetStringByColIndex(colIndex, rowIndexes[rowIndex])
+			if err != nil {
+				return 0, err
+			}
+			stringOffsets[rowIndex] = builder.CreateString(cell)
+		}
+
+		builder.StartVector(elementSize, rowCount, elementSize)
+		for rowIndex := rowCount - 1; rowIndex >= 0; rowIndex-- {
+			builder.PrependUOffsetT(stringOffsets[rowIndex])
+		}
+
+		return builder.EndVector(rowCount), nil
+	}
+
+	builder.StartVector(elementSize, rowCount, elementSize)
+	for rowIndex := rowCount - 1; rowIndex >= 0; rowIndex-- {
+		err = prependCell(builder, table, colType, colIndex, rowIndexes[rowIndex])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return builder.EndVector(rowCount), nil
+}
+
+// prependCell() prepends the scalar cell at colIndex, rowIndex to the vector being built.
+func prependCell(builder *flatbuffers.Builder, table *gotables.Table, colType string, colIndex int, rowIndex int) error {
+	switch colType {
+	case "bool":
+		cell, err := table.GetBoolByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependBool(cell)
+	case "int8":
+		cell, err := table.GetInt8ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependInt8(cell)
+	case "int16":
+		cell, err := table.GetInt16ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependInt16(cell)
+	case "int32":
+		cell, err := table.GetInt32ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependInt32(cell)
+	case "int64":
+		cell, err := table.GetInt64ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependInt64(cell)
+	case "byte":
+		cell, err := table.GetByteByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependByte(cell)
+	case "uint8":
+		cell, err := table.GetUint8ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependUint8(cell)
+	case "uint16":
+		cell, err := table.GetUint16ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependUint16(cell)
+	case "uint32":
+		cell, err := table.GetUint32ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependUint32(cell)
+	case "uint64":
+		cell, err := table.GetUint64ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependUint64(cell)
+	case "float32":
+		cell, err := table.GetFloat32ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependFloat32(cell)
+	case "float64":
+		cell, err := table.GetFloat64ByColIndex(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		builder.PrependFloat64(cell)
+	default:
+		return fmt.Errorf("[%s] col %d: unsupported FlatTables col type: %s", table.Name(), colIndex, colType)
+	}
+
+	return nil
+}
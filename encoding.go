@@ -0,0 +1,245 @@
+package flattables
+
+// The delta, delta-of-delta and run-length encoded cols that encodeTableSet() builds, as the generated code does.
+// See EncodeAnnotation and Encoding_template.
+
+import (
+	"fmt"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/urban-wombat/gotables"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+buildEncodedVectors() builds col colIndex of table encoded with encoding (see EncodeAnnotation), exactly as the generated
+encoders do: the <colName>Values vector, and the vector of deltas or run ends, of entryBits bits per entry.
+It returns their offsets and entryBits. Row i of the col is row rowIndexes[i] of table.
+*/
+func buildEncodedVectors(builder *flatbuffers.Builder, table *gotables.Table, colIndex int, rowIndexes []int,
+	encoding string) (valuesVector flatbuffers.UOffsetT, entriesVector flatbuffers.UOffsetT, entryBits int, err error) {
+	colType, err := table.ColTypeByColIndex(colIndex)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var values []int64 = make([]int64, len(rowIndexes))
+	for rowIndex := 0; rowIndex < len(rowIndexes); rowIndex++ {
+		val, err := table.GetValByColIndex(colIndex, rowIndexes[rowIndex])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		values[rowIndex], err = encodedVal(val)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("[%s] col %d: %v", table.Name(), colIndex, err)
+		}
+	}
+
+	var heads []int64
+	var entries []int64
+	if encoding == EncodingRunLength {
+		heads, entries = encodeRunLength(values)
+		entryBits = 32
+	} else {
+		heads, entries, entryBits = encodeDelta(values, flatBuffersElementSizes[colType]*8, encoding == EncodingDeltaOfDelta)
+	}
+
+	var elementSize int = flatBuffersElementSizes[colType]
+	builder.StartVector(elementSize, len(heads), elementSize)
+	for headIndex := len(heads) - 1; headIndex >= 0; headIndex-- {
+		prependHead(builder, colType, heads[headIndex])
+	}
+	valuesVector = builder.EndVector(len(heads))
+
+	builder.StartVector(entryBits/8, len(entries), entryBits/8)
+	for rowIndex := len(entries) - 1; rowIndex >= 0; rowIndex-- {
+		switch {
+		case encoding == EncodingRunLength:
+			builder.PrependUint32(uint32(entries[rowIndex]))
+		case entryBits == 8:
+			builder.PrependInt8(int8(entries[rowIndex]))
+		case entryBits == 16:
+			builder.PrependInt16(int16(entries[rowIndex]))
+		case entryBits == 32:
+			builder.PrependInt32(int32(entries[rowIndex]))
+		default:
+			builder.PrependInt64(entries[rowIndex])
+		}
+	}
+	entriesVector = builder.EndVector(len(entries))
+
+	return valuesVector, entriesVector, entryBits, nil
+}
+
+/*
+encodedFieldCount() returns the number of fields that may hold the entries of a col of colType encoded with encoding:
+a delta vector of each size up to the size of the col, or the run ends.
+*/
+func encodedFieldCount(colType string, encoding string) int {
+	if encoding == EncodingRunLength {
+		return 1
+	}
+
+	var count int
+	for bits := 8; bits <= flatBuffersElementSizes[colType]*8; bits *= 2 {
+		count++
+	}
+
+	return count
+}
+
+// encodedColField() returns the field of entries of entryBits among the fields of a col encoded with encoding. See colSlot().
+func encodedColField(encoding string, entryBits int) int {
+	if encoding == EncodingRunLength {
+		return colRunEndsField
+	}
+
+	var field int = colDeltasField
+	for bits := 8; bits < entryBits; bits *= 2 {
+		field++
+	}
+
+	return field
+}
+
+// encodedVal() returns an integer or bool cell as the int64 that the generated encoders add. uint64 cells wrap.
+func encodedVal(val interface{}) (int64, error) {
+	switch val := val.(type) {
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case int8:
+		return int64(val), nil
+	case int16:
+		return int64(val), nil
+	case int32:
+		return int64(val), nil
+	case int64:
+		return val, nil
+	case uint8:
+		return int64(val), nil
+	case uint16:
+		return int64(val), nil
+	case uint32:
+		return int64(val), nil
+	case uint64:
+		return int64(val), nil
+	default:
+		return 0, fmt.Errorf("encoded col type %T is not an integer or bool", val)
+	}
+}
+
+// signExtend() returns the low bits of value as a signed integer.
+func signExtend(value int64, bits int) int64 {
+	var shift uint = uint(64 - bits)
+	return value << shift >> shift
+}
+
+/*
+encodeDelta() returns the heads and entries of values delta-encoded (or delta-of-delta encoded if ofDelta) in blocks
+of deltaBlockRows rows, with the differences taken modulo colBits, and the fewest bits that fit every entry.
+Delta of delta has two heads per block: its first value, and the delta from it to the next row.
+*/
+func encodeDelta(values []int64, colBits int, ofDelta bool) (heads []int64, entries []int64, entryBits int) {
+	entries = make([]int64, 0, len(values))
+	var prevValue, prevDelta int64
+	var minEntry, maxEntry int64
+	for rowIndex, value := range values {
+		if rowIndex%deltaBlockRows == 0 {
+			heads = append(heads, value)
+			entries = append(entries, 0)
+			prevValue, prevDelta = value, 0
+			if ofDelta {
+				// The head delta of the block (to the next row), so the first deltas of deltas are small too.
+				if rowIndex+1 < len(values) {
+					prevDelta = signExtend(values[rowIndex+1]-value, colBits)
+				}
+				heads = append(heads, prevDelta)
+			}
+			continue
+		}
+		delta := signExtend(value-prevValue, colBits)
+		entry := delta
+		if ofDelta {
+			entry = signExtend(delta-prevDelta, colBits)
+		}
+		entries = append(entries, entry)
+		prevValue, prevDelta = value, delta
+
+		if entry < minEntry {
+			minEntry = entry
+		}
+		if entry > maxEntry {
+			maxEntry = entry
+		}
+	}
+
+	for entryBits = 8; entryBits < colBits; entryBits *= 2 {
+		if minEntry >= -1<<uint(entryBits-1) && maxEntry < 1<<uint(entryBits-1) {
+			break
+		}
+	}
+
+	return heads, entries, entryBits
+}
+
+// encodeRunLength() returns the value of each run of equal values, and the row each run ends at (exclusive).
+func encodeRunLength(values []int64) (heads []int64, runEnds []int64) {
+	for rowIndex, value := range values {
+		if rowIndex > 0 && value == values[rowIndex-1] {
+			runEnds[len(runEnds)-1]++
+			continue
+		}
+		heads = append(heads, value)
+		runEnds = append(runEnds, int64(rowIndex+1))
+	}
+
+	return heads, runEnds
+}
+
+// prependHead() prepends a head value of an encoded col of colType to the vector being built.
+func prependHead(builder *flatbuffers.Builder, colType string, head int64) {
+	switch colType {
+	case "bool":
+		builder.PrependBool(head != 0)
+	case "int8":
+		builder.PrependInt8(int8(head))
+	case "int16":
+		builder.PrependInt16(int16(head))
+	case "int32":
+		builder.PrependInt32(int32(head))
+	case "int64":
+		builder.PrependInt64(head)
+	case "byte", "uint8":
+		builder.PrependUint8(uint8(head))
+	case "uint16":
+		builder.PrependUint16(uint16(head))
+	case "uint32":
+		builder.PrependUint32(uint32(head))
+	default:
+		builder.PrependUint64(uint64(head))
+	}
+}
@@ -101,6 +101,21 @@ var goFlatBuffersScalarTypes = map[string]string{
 
 const deprecated = "_deprecated_"
 
+// The suffix of the stats table that the schema has alongside each table.
+const statsSuffix = "Stats"
+
+// The suffixes of the fields of FlatTables that record the codec and uncompressed size of a compressed table.
+const (
+	codecSuffix = "Codec"
+	sizeSuffix  = "Size"
+)
+
+// The suffix of the field of FlatTables that records the checksum of a checksummed table.
+const checksumSuffix = "Checksum"
+
+// The field of FlatTables that embeds the gotables metadata of the tables. See MetadataAnnotation.
+const metadataField = "TableSetMetadata"
+
 func schemaType(colType string) (string, error) {
 	schemaType, exists := goToFlatBuffersTypes[colType]
 	if exists {
@@ -246,6 +261,7 @@ type GenerationInfo struct {
 	FuncName     string   // Used as basename of *.template and *.go files. Not always a function name.
 	Imports      []string // imports for this template.
 	TemplateText []byte
+	NestedOnly   bool // Not generated for SingleLayout.
 }
 
 var generations = []GenerationInfo{
@@ -259,9 +275,20 @@ var generations = []GenerationInfo{
 		TemplateText: test_template,
 		Imports: []string{
 			`"bytes"`,
+			`"context"`,
+			`"crypto/ed25519"`,
+			`"encoding/json"`,
 			`"fmt"`,
+			`"github.com/urban-wombat/flattables"`,
 			`"github.com/urban-wombat/gotables"`,
+			`"io"`,
+			`"io/ioutil"`,
+			`"net/http"`,
+			`"net/http/httptest"`,
+			`"os"`,
+			`"path/filepath"`,
 			`"reflect"`,
+			`"strings"`,
 			`"testing"`,
 		},
 	},
@@ -313,6 +340,270 @@ var generations = []GenerationInfo{
 			`"fmt"`,
 		},
 	},
+	{TemplateType: "flattables",
+		FuncName:     "Chunks", // Not really a function name.
+		TemplateText: Chunks_template,
+		Imports: []string{
+			`"encoding/binary"`,
+			`"fmt"`,
+			`"io"`,
+			`"math"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Verify",
+		TemplateText: Verify_template,
+		Imports: []string{
+			`flatbuffers "github.com/google/flatbuffers/go"`,
+			`"fmt"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "OpenFile",
+		TemplateText: OpenFile_template,
+		Imports: []string{
+			`"fmt"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "OpenFile_linux", // File name suffix _linux.go restricts it to Linux.
+		TemplateText: OpenFile_linux_template,
+		Imports: []string{
+			`"fmt"`,
+			`"math"`,
+			`"os"`,
+			`"syscall"`,
+			`"unsafe"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "OpenFile_other", // Build constraint !linux
+		TemplateText: OpenFile_other_template,
+		Imports: []string{
+			`"fmt"`,
+			`"io/ioutil"`,
+			`"math"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Encoder",
+		TemplateText: Encoder_template,
+		Imports: []string{
+			`flatbuffers "github.com/google/flatbuffers/go"`,
+			`"fmt"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Parallel", // Not really a function name.
+		TemplateText: Parallel_template,
+		NestedOnly:   true, // Tables built in one builder can't be encoded concurrently.
+		Imports: []string{
+			`"github.com/urban-wombat/gotables"`,
+			`"fmt"`,
+			`"sync"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Parallel_test", // Not really a function name.
+		TemplateText: Parallel_test_template,
+		NestedOnly:   true,
+		Imports: []string{
+			`"bytes"`,
+			`"github.com/urban-wombat/gotables"`,
+			`"reflect"`,
+			`"runtime"`,
+			`"testing"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Diff", // Not really a function name.
+		TemplateText: Diff_template,
+		Imports: []string{
+			`"bytes"`,
+			`"fmt"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "JSON", // Not really a function name.
+		TemplateText: JSON_template,
+		Imports: []string{
+			`"encoding/json"`,
+			`"fmt"`,
+			`"io"`,
+			`"math"`,
+			`"strconv"`,
+			`"unicode"`,
+			`"unicode/utf8"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "CSV", // Not really a function name.
+		TemplateText: CSV_template,
+		Imports: []string{
+			`"encoding/csv"`,
+			`"fmt"`,
+			`"io"`,
+			`"strconv"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "SQL", // Not really a function name.
+		TemplateText: SQL_template,
+		Imports: []string{
+			`"context"`,
+			`"database/sql"`,
+			`"fmt"`,
+			`"strings"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "SQL_test", // Not really a function name.
+		TemplateText: SQL_test_template,
+		Imports: []string{
+			`"context"`,
+			`"database/sql"`,
+			`"database/sql/driver"`,
+			`"fmt"`,
+			`"github.com/urban-wombat/gotables"`,
+			`"io"`,
+			`"reflect"`,
+			`"strings"`,
+			`"testing"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "TableSetFromSlice", // Not really a function name.
+		TemplateText: TableSetFromSlice_template,
+		Imports: []string{
+			`"github.com/urban-wombat/gotables"`,
+			`"fmt"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Mutate", // Not really a function name.
+		TemplateText: Mutate_template,
+		Imports:      []string{},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Patch", // Not really a function name.
+		TemplateText: Patch_template,
+		NestedOnly:   true, // Copies untouched tables verbatim as nested FlatBuffers.
+		Imports: []string{
+			`"fmt"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Patch_test", // Not really a function name.
+		TemplateText: Patch_test_template,
+		NestedOnly:   true,
+		Imports: []string{
+			`"bytes"`,
+			`"github.com/urban-wombat/gotables"`,
+			`"reflect"`,
+			`"testing"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Merge", // Not really a function name.
+		TemplateText: Merge_template,
+		Imports: []string{
+			`"fmt"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Stats", // Not really a function name.
+		TemplateText: Stats_template,
+		Imports: []string{
+			`flatbuffers "github.com/google/flatbuffers/go"`,
+			`"github.com/urban-wombat/gotables"`,
+			`"math"`,
+			`"math/bits"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Keys", // Not really a function name.
+		TemplateText: Keys_template,
+		Imports: []string{
+			`"github.com/urban-wombat/gotables"`,
+			`"fmt"`,
+			`"sort"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Indexes", // Not really a function name.
+		TemplateText: Indexes_template,
+		Imports: []string{
+			`flatbuffers "github.com/google/flatbuffers/go"`,
+			`"sort"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Dict", // Not really a function name.
+		TemplateText: Dict_template,
+		Imports: []string{
+			`flatbuffers "github.com/google/flatbuffers/go"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Encoding", // Not really a function name.
+		TemplateText: Encoding_template,
+		Imports: []string{
+			`flatbuffers "github.com/google/flatbuffers/go"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Compress", // Not really a function name.
+		TemplateText: Compress_template,
+		NestedOnly:   true, // Only nested FlatBuffers bytes can be compressed.
+		Imports: []string{
+			`flatbuffers "github.com/google/flatbuffers/go"`,
+			`"bytes"`,
+			`"compress/flate"`,
+			`"compress/gzip"`,
+			`"fmt"`,
+			`"io"`,
+			`"io/ioutil"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Checksum", // Not really a function name.
+		TemplateText: Checksum_template,
+		NestedOnly:   true, // Only nested FlatBuffers bytes are checksummed.
+		Imports: []string{
+			`"fmt"`,
+			`"hash/crc32"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "Sign", // Not really a function name.
+		TemplateText: Sign_template,
+		Imports: []string{
+			`"crypto/ed25519"`,
+			`"crypto/hmac"`,
+			`"crypto/sha256"`,
+			`"fmt"`,
+			`"github.com/urban-wombat/gotables"`,
+		},
+	},
+	{TemplateType: "flattables",
+		FuncName:     "HTTP", // Not really a function name.
+		TemplateText: HTTP_template,
+		Imports: []string{
+			`"bytes"`,
+			`"context"`,
+			`"crypto/sha256"`,
+			`"encoding/hex"`,
+			`"fmt"`,
+			`"io/ioutil"`,
+			`"net/http"`,
+			`"net/url"`,
+			`"strconv"`,
+			`"strings"`,
+			`"sync"`,
+			`"time"`,
+			`"github.com/urban-wombat/gotables"`,
+		},
+	},
 	{TemplateType: "flattables",
 		FuncName:     "main", // Not really a function name.
 		TemplateText: main_template,
@@ -326,6 +617,13 @@ var generations = []GenerationInfo{
 func GenerateAll(tablesTemplateInfo TablesTemplateInfoType, verbose bool, dryRun bool) error {
 	//where(fmt.Sprintf("WHAT? %s", tablesTemplateInfo.OutDirMainAbsolute))
 	for _, generation := range generations {
+		if generation.NestedOnly && tablesTemplateInfo.SingleLayout {
+			if verbose {
+				fmt.Printf("     Skipping:   %-12s %s (nested layout only)\n", fmt.Sprintf("(%s)", generation.TemplateType), generation.FuncName)
+			}
+			continue
+		}
+
 		// tablesTemplateInfo is global.
 		err := generateGoCodeFromTemplate(generation, tablesTemplateInfo, verbose, dryRun)
 		if err != nil {
@@ -535,20 +833,33 @@ type ColInfo struct {
 	IsString     bool
 	IsBool       bool
 	IsDeprecated bool
+	IsKey        bool   // See KeyAnnotation.
+	IsIndexed    bool   // See IndexAnnotation.
+	IsDict       bool   // See DictAnnotation.
+	Encoding     string // EncodingDelta, EncodingDeltaOfDelta or EncodingRunLength if the col is encoded. See EncodeAnnotation.
+	DeltaBits    []int  // The bits of each delta vector of a delta or delta-of-delta encoded col: 8 up to the bits of the col.
 }
 
 type Row []string
 
 type TableInfo struct {
-	Table      *gotables.Table
-	TableIndex int
-	TableName  string
-	RowCount   int
-	ColCount   int
-	Cols       []ColInfo
-	Rows       []Row
-	ColNames   []string
-	ColTypes   []string
+	Table       *gotables.Table
+	TableIndex  int
+	TableName   string
+	RowCount    int
+	ColCount    int
+	Cols        []ColInfo
+	Rows        []Row
+	ColNames    []string
+	ColTypes    []string
+	KeyCols     []ColInfo // In key order. Empty if the table has no key. See KeyAnnotation.
+	KeyName     string    // The key col names joined in UpperCamelCase, such as RegionOrderId.
+	IndexCols   []ColInfo // The cols with a secondary index, in declared order. See IndexAnnotation.
+	DictCols    []ColInfo // The dictionary-encoded string cols, in declared order. See DictAnnotation.
+	EncodedCols []ColInfo // The delta, delta-of-delta and run-length encoded cols, in col order. See EncodeAnnotation.
+	Reserved    []int     // The slots of the placeholders from the last col vector up to the fields of the cols. See colSlot().
+	Codec       string    // CodecFlate or CodecGzip if the table is stored compressed, otherwise empty. See CompressAnnotation.
+	Checksum    bool      // FlatTables records a checksum of the stored bytes of the table. See ChecksumAnnotation.
 }
 
 type TablesTemplateInfoType struct {
@@ -572,10 +883,26 @@ type TablesTemplateInfoType struct {
 	GotablesFileNameAbsolute string
 	GotablesFileNameBase     string
 	TableSetMetadata         string
+	FlatTablesMetadata       string // Embedded in FlatTables if declared with MetadataAnnotation, or "".
 	TableSetData             string
 	Tables                   []TableInfo
+	SingleLayout             bool // See SingleLayout const.
 }
 
+/*
+Layouts of the root table FlatTables, selected at generation time with flattablesc -l <layout>
+
+NestedLayout (the default) finishes each data table in its own builder and stores it in FlatTables
+as a [ubyte] nested_flatbuffer. Each table can be extracted (or replaced) as a self-contained buffer.
+
+SingleLayout builds the data tables in the same builder as FlatTables, as direct child tables.
+This avoids copying every table into FlatTables, and readers need no GetRootAs on nested bytes.
+*/
+const (
+	NestedLayout = "nested"
+	SingleLayout = "single"
+)
+
 var TablesTemplateInfo TablesTemplateInfoType
 
 func (tablesTemplateInfo TablesTemplateInfoType) Name(tableIndex int) string {
@@ -608,6 +935,36 @@ func InitTablesTemplateInfo(tableSet *gotables.TableSet, packageName string) (Ta
 	var emptyTemplateInfo TablesTemplateInfoType
 	var tablesTemplateInfo TablesTemplateInfoType
 
+	// Key cols, indexed cols, dictionary-encoded cols, encoded cols, compressed and checksummed tables, and embedded
+	// metadata declared in the gotables file. See KeyAnnotation, IndexAnnotation, DictAnnotation, EncodeAnnotation,
+	// CompressAnnotation, ChecksumAnnotation and MetadataAnnotation.
+	annotations, err := annotationsFromFile(tableSet.FileName())
+	if err != nil {
+		return emptyTemplateInfo, err
+	}
+	var keys map[string][]string = annotations.keys
+	var indexes map[string][]string = annotations.indexes
+	var dicts map[string][]string = annotations.dicts
+	var encodings map[string]map[string]string = annotations.encodings
+	var codecs map[string]string = annotations.codecs
+	var checksums map[string]bool = annotations.checksums
+	var metadata bool = annotations.metadata
+
+	// The annotations as FlatTables embeds them with the metadata, before the tables below take theirs from the maps.
+	var metadataAnnotationLines []string = annotationLines(annotations)
+
+	if metadata {
+		// FlatTables embeds the metadata in field TableSetMetadata.
+		hasTable, err := tableSet.HasTable(metadataField)
+		if err != nil {
+			return emptyTemplateInfo, err
+		}
+		if hasTable {
+			return emptyTemplateInfo, fmt.Errorf("table [%s] clashes with the field of %s. Rename [%s]",
+				metadataField, MetadataAnnotation, metadataField)
+		}
+	}
+
 	var tables []TableInfo = make([]TableInfo, tableSet.TableCount())
 	for tableIndex := 0; tableIndex < tableSet.TableCount(); tableIndex++ {
 		table, err := tableSet.TableByTableIndex(tableIndex)
@@ -645,6 +1002,19 @@ func InitTablesTemplateInfo(tableSet *gotables.TableSet, packageName string) (Ta
 				fmt.Errorf("cannot use underscores '_' in table names. Rename [%s]", table.Name())
 		}
 
+		// Each table has a stats table named <table>Stats in the schema.
+		if strings.HasSuffix(table.Name(), statsSuffix) {
+			hasTable, err := tableSet.HasTable(strings.TrimSuffix(table.Name(), statsSuffix))
+			if err != nil {
+				return emptyTemplateInfo, err
+			}
+			if hasTable {
+				return emptyTemplateInfo,
+					fmt.Errorf("table [%s] clashes with the stats table of [%s]. Rename [%s]",
+						table.Name(), strings.TrimSuffix(table.Name(), statsSuffix), table.Name())
+			}
+		}
+
 		tables[tableIndex].Table = table // An array of Table accessible as .Tables
 
 		var cols []ColInfo = make([]ColInfo, table.ColCount())
@@ -749,33 +1119,113 @@ func InitTablesTemplateInfo(tableSet *gotables.TableSet, packageName string) (Ta
 		tables[tableIndex].Rows = rows
 		tables[tableIndex].ColNames = colNames
 		tables[tableIndex].ColTypes = colTypes
-	}
 
-	// Get tableset metadata.
-	// Make a copy of the tables and use them as metadata-only.
-	// We end up with 2 instances of TableSet:-
-	// (1) tableSet which contains data.            Is accessible in templates as: .Tables           (an array of Table)
-	// (2) metadataTableSet which contains NO data. Is accessible in templates as: .TableSetMetadata (a TableSet)
+		keyColNames, hasKey := keys[table.Name()]
+		if hasKey {
+			err = setKeyCols(&tables[tableIndex], keyColNames)
+			if err != nil {
+				return emptyTemplateInfo, err
+			}
+			delete(keys, table.Name())
+		}
 
-	const copyRows = false                           // i.e., don't copy rows.
-	metadataTableSet, err := tableSet.Copy(copyRows) // Accessible as
-	if err != nil {
-		return emptyTemplateInfo, err
-	}
+		indexColNames, hasIndexes := indexes[table.Name()]
+		if hasIndexes {
+			err = setIndexCols(&tables[tableIndex], indexColNames)
+			if err != nil {
+				return emptyTemplateInfo, err
+			}
+			delete(indexes, table.Name())
+		}
 
-	for tableIndex := 0; tableIndex < metadataTableSet.TableCount(); tableIndex++ {
-		table, err := metadataTableSet.TableByTableIndex(tableIndex)
-		if err != nil {
-			return emptyTemplateInfo, err
+		dictColNames, hasDicts := dicts[table.Name()]
+		if hasDicts {
+			err = setDictCols(&tables[tableIndex], dictColNames)
+			if err != nil {
+				return emptyTemplateInfo, err
+			}
+			delete(dicts, table.Name())
 		}
 
-		err = table.SetStructShape(true)
+		colEncodings, hasEncodings := encodings[table.Name()]
+		if hasEncodings {
+			err = setEncodedCols(&tables[tableIndex], colEncodings)
+			if err != nil {
+				return emptyTemplateInfo, err
+			}
+			delete(encodings, table.Name())
+		}
+
+		err = setReserved(&tables[tableIndex])
 		if err != nil {
 			return emptyTemplateInfo, err
 		}
+
+		codec, isCompressed := codecs[table.Name()]
+		if isCompressed {
+			// FlatTables records the codec and uncompressed size of the table in fields <TableName>Codec and <TableName>Size.
+			for _, suffix := range []string{codecSuffix, sizeSuffix} {
+				hasTable, err := tableSet.HasTable(table.Name() + suffix)
+				if err != nil {
+					return emptyTemplateInfo, err
+				}
+				if hasTable {
+					return emptyTemplateInfo,
+						fmt.Errorf("table [%s] clashes with the %s field of compressed table [%s]. Rename [%s]",
+							table.Name()+suffix, strings.ToLower(suffix), table.Name(), table.Name()+suffix)
+				}
+			}
+			tables[tableIndex].Codec = codec
+			delete(codecs, table.Name())
+		}
+
+		if checksums[table.Name()] {
+			// FlatTables records the checksum of the table in field <TableName>Checksum.
+			hasTable, err := tableSet.HasTable(table.Name() + checksumSuffix)
+			if err != nil {
+				return emptyTemplateInfo, err
+			}
+			if hasTable {
+				return emptyTemplateInfo,
+					fmt.Errorf("table [%s] clashes with the checksum field of checksummed table [%s]. Rename [%s]",
+						table.Name()+checksumSuffix, table.Name(), table.Name()+checksumSuffix)
+			}
+			tables[tableIndex].Checksum = true
+			delete(checksums, table.Name())
+		}
+	}
+
+	for tableName := range keys {
+		return emptyTemplateInfo, fmt.Errorf("%s [%s]: there is no table [%s]", KeyAnnotation, tableName, tableName)
+	}
+	for tableName := range indexes {
+		return emptyTemplateInfo, fmt.Errorf("%s [%s]: there is no table [%s]", IndexAnnotation, tableName, tableName)
+	}
+	for tableName := range dicts {
+		return emptyTemplateInfo, fmt.Errorf("%s [%s]: there is no table [%s]", DictAnnotation, tableName, tableName)
+	}
+	for tableName := range encodings {
+		return emptyTemplateInfo, fmt.Errorf("%s [%s]: there is no table [%s]", EncodeAnnotation, tableName, tableName)
+	}
+	for tableName := range codecs {
+		return emptyTemplateInfo, fmt.Errorf("%s [%s]: there is no table [%s]", CompressAnnotation, tableName, tableName)
+	}
+	for tableName := range checksums {
+		return emptyTemplateInfo, fmt.Errorf("%s [%s]: there is no table [%s]", ChecksumAnnotation, tableName, tableName)
+	}
+
+	// Get tableset metadata: the tables with no data. Is accessible in templates as: .TableSetMetadata
+	tableSetMetadata, err := metadataText(tableSet)
+	if err != nil {
+		return emptyTemplateInfo, err
+	}
+
+	// Embedded in FlatTables. Is accessible in templates as: .FlatTablesMetadata
+	var flatTablesMetadata string
+	if metadata {
+		flatTablesMetadata = embeddedMetadata(metadataAnnotationLines, tableSetMetadata)
 	}
 
-	tableSetMetadata := metadataTableSet.String()
 	tableSetMetadata = indentText("\t\t", tableSetMetadata)
 
 	tableSetData := tableSet.String()
@@ -793,6 +1243,7 @@ func InitTablesTemplateInfo(tableSet *gotables.TableSet, packageName string) (Ta
 		NameSpace:                     tableSet.Name(),
 		PackageName:                   packageName,
 		TableSetMetadata:              tableSetMetadata,
+		FlatTablesMetadata:            flatTablesMetadata,
 		TableSetData:                  tableSetData,
 		Tables:                        tables,
 	}
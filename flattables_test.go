@@ -1,8 +1,22 @@
 package flattables
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
 	"go/token"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/urban-wombat/gotables"
 )
 
 func TestIsGoKeyword(t *testing.T) {
@@ -50,3 +64,1045 @@ func TestIsGoKeyword(t *testing.T) {
 		}
 	}
 }
+
+func TestAppendRowsFromCSV(t *testing.T) {
+	var tests = []struct {
+		csv       string
+		rowCount  int
+		expectErr bool
+	}{
+		{"name,count,ok,ratio\n\"a,b\",1,true,0.5\nc,-2,false,1e3\n", 2, false},
+		{"ratio,ok,count,name\n0.5,1,3,x\n", 1, false}, // Cols in any order.
+		{"name,count,ok,ratio\n", 0, false},
+		{"", 0, true},                                    // No header row.
+		{"name,count,ok\nx,1,true\n", 0, true},           // Missing col.
+		{"name,count,ok,ratio,extra\n", 0, true},         // Unknown col.
+		{"name,count,ok,name\n", 0, true},                // Duplicate col.
+		{"name,count,ok,ratio\nx,128,true,0\n", 0, true}, // Out of range for int8.
+		{"name,count,ok,ratio\nx,1,yes,0\n", 0, true},    // Not a bool.
+		{"name,count,ok,ratio\nx,1,true\n", 0, true},     // Too few fields.
+	}
+
+	for i, test := range tests {
+		table, err := gotables.NewTableFromMetadata("T", []string{"name", "count", "ok", "ratio"}, []string{"string", "int8", "bool", "float32"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = AppendRowsFromCSV(table, strings.NewReader(test.csv))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from CSV %q", i, test.csv)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if table.RowCount() != test.rowCount {
+			t.Errorf("test[%d] expecting %d rows, not %d", i, test.rowCount, table.RowCount())
+		}
+	}
+}
+
+func TestKeysFromText(t *testing.T) {
+	var tests = []struct {
+		text      string
+		keys      map[string][]string
+		expectErr bool
+	}{
+		{"[Users]\nid int64\n", map[string][]string{}, false},
+		{"//flattables:key Users id\n[Users]\nid int64\n", map[string][]string{"Users": {"id"}}, false},
+		{"  //flattables:key  Orders region orderId \n", map[string][]string{"Orders": {"region", "orderId"}}, false},
+		{"// flattables:key Users id\n", map[string][]string{}, false}, // Not an annotation.
+		{"//flattables:key Users\n", nil, true},                        // No key cols.
+		{"//flattables:key Users id\n//flattables:key Users name\n", nil, true},
+	}
+
+	for i, test := range tests {
+		keys, err := keysFromText(bufio.NewScanner(strings.NewReader(test.text)))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from %q", i, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("test[%d] expecting keys %v, not %v", i, test.keys, keys)
+		}
+	}
+}
+
+func TestIndexesFromText(t *testing.T) {
+	var tests = []struct {
+		text      string
+		indexes   map[string][]string
+		expectErr bool
+	}{
+		{"[Users]\nid int64\n", map[string][]string{}, false},
+		{"//flattables:index Orders status region\n", map[string][]string{"Orders": {"status", "region"}}, false},
+		{"//flattables:index Orders status\n//flattables:key Orders id\n//flattables:index Orders region\n", map[string][]string{"Orders": {"status", "region"}}, false},
+		{"//flattables:index Orders\n", nil, true}, // No indexed cols.
+	}
+
+	for i, test := range tests {
+		indexes, err := indexesFromText(bufio.NewScanner(strings.NewReader(test.text)))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from %q", i, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(indexes, test.indexes) {
+			t.Errorf("test[%d] expecting indexes %v, not %v", i, test.indexes, indexes)
+		}
+	}
+}
+
+func TestDictsFromText(t *testing.T) {
+	var tests = []struct {
+		text      string
+		dicts     map[string][]string
+		expectErr bool
+	}{
+		{"[Users]\nid int64\n", map[string][]string{}, false},
+		{"//flattables:dict Orders status country\n", map[string][]string{"Orders": {"status", "country"}}, false},
+		{"//flattables:dict Orders status\n//flattables:index Orders id\n//flattables:dict Orders country\n", map[string][]string{"Orders": {"status", "country"}}, false},
+		{"//flattables:dict Orders\n", nil, true}, // No dictionary-encoded cols.
+	}
+
+	for i, test := range tests {
+		dicts, err := dictsFromText(bufio.NewScanner(strings.NewReader(test.text)))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from %q", i, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(dicts, test.dicts) {
+			t.Errorf("test[%d] expecting dicts %v, not %v", i, test.dicts, dicts)
+		}
+	}
+}
+
+func TestEncodingsFromText(t *testing.T) {
+	var tests = []struct {
+		text      string
+		encodings map[string]map[string]string
+		expectErr bool
+	}{
+		{"[Users]\nid int64\n", map[string]map[string]string{}, false},
+		{"//flattables:encode Events delta seq\n//flattables:encode Events rle active flag\n",
+			map[string]map[string]string{"Events": {"seq": "delta", "active": "rle", "flag": "rle"}}, false},
+		{"//flattables:encode Events deltadelta timestamp\n", map[string]map[string]string{"Events": {"timestamp": "deltadelta"}}, false},
+		{"//flattables:encode Events delta\n", nil, true},                                         // No cols.
+		{"//flattables:encode Events zigzag seq\n", nil, true},                                    // Unknown encoding.
+		{"//flattables:encode Events delta seq\n//flattables:encode Events rle seq\n", nil, true}, // Encoded twice.
+	}
+
+	for i, test := range tests {
+		encodings, err := encodingsFromText(bufio.NewScanner(strings.NewReader(test.text)))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from %q", i, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(encodings, test.encodings) {
+			t.Errorf("test[%d] expecting encodings %v, not %v", i, test.encodings, encodings)
+		}
+	}
+}
+
+func TestCodecsFromText(t *testing.T) {
+	var tests = []struct {
+		text      string
+		codecs    map[string]string
+		expectErr bool
+	}{
+		{"[Users]\nid int64\n", map[string]string{}, false},
+		{"//flattables:compress History flate\n//flattables:compress Archive gzip\n", map[string]string{"History": "flate", "Archive": "gzip"}, false},
+		{"//flattables:compress History\n", nil, true},            // No codec.
+		{"//flattables:compress History flate gzip\n", nil, true}, // Two codecs.
+		{"//flattables:compress History zstd\n", nil, true},       // Unknown codec.
+		{"//flattables:compress History flate\n//flattables:compress History gzip\n", nil, true},
+	}
+
+	for i, test := range tests {
+		codecs, err := codecsFromText(bufio.NewScanner(strings.NewReader(test.text)))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from %q", i, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(codecs, test.codecs) {
+			t.Errorf("test[%d] expecting codecs %v, not %v", i, test.codecs, codecs)
+		}
+	}
+}
+
+func TestChecksumsFromText(t *testing.T) {
+	var tests = []struct {
+		text      string
+		checksums map[string]bool
+		expectErr bool
+	}{
+		{"[Users]\nid int64\n", map[string]bool{}, false},
+		{"//flattables:checksum History Archive\n//flattables:checksum Users\n", map[string]bool{"History": true, "Archive": true, "Users": true}, false},
+		{"//flattables:checksum\n", nil, true},                 // No table.
+		{"//flattables:checksum History History\n", nil, true}, // Twice.
+		{"//flattables:checksum History\n//flattables:checksum Archive History\n", nil, true},
+	}
+
+	for i, test := range tests {
+		checksums, err := checksumsFromText(bufio.NewScanner(strings.NewReader(test.text)))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from %q", i, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(checksums, test.checksums) {
+			t.Errorf("test[%d] expecting checksums %v, not %v", i, test.checksums, checksums)
+		}
+	}
+}
+
+func TestMetadataFromText(t *testing.T) {
+	var tests = []struct {
+		text      string
+		metadata  bool
+		expectErr bool
+	}{
+		{"[Users]\nid int64\n", false, false},
+		{"//flattables:metadata\n[Users]\nid int64\n", true, false},
+		{"  //flattables:metadata  \n", true, false},
+		{"//flattables:metadata Users\n", false, true},                  // Not on its own.
+		{"//flattables:metadata\n//flattables:metadata\n", false, true}, // Twice.
+	}
+
+	for i, test := range tests {
+		metadata, err := metadataFromText(bufio.NewScanner(strings.NewReader(test.text)))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("test[%d] expecting an error from %q", i, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		if metadata != test.metadata {
+			t.Errorf("test[%d] expecting metadata %t, not %t", i, test.metadata, metadata)
+		}
+	}
+}
+
+func TestEmbeddedMetadata(t *testing.T) {
+	tableSet, err := gotables.NewTableSet("Metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := gotables.NewTableFromMetadata("Orders", []string{"region", "orderId"}, []string{"string", "int32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.AppendRows(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tableSet.AppendTable(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := metadataText(tableSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, layout := range []string{NestedLayout, SingleLayout} {
+		const metadata = true
+		flatBuffers, err := encodeTableSet(tableSet, layout, nil, nil, nil, nil, nil, nil, metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		embedded, err := embeddedMetadataOf(flatBuffers)
+		if err != nil {
+			t.Fatalf("%s: %v", layout, err)
+		}
+		if embedded != embeddedMetadata(nil, text) {
+			t.Errorf("%s: embedded metadata %q, expecting %q", layout, embedded, embeddedMetadata(nil, text))
+		}
+
+		// No panic, whatever the bytes.
+		for byteIndex := 0; byteIndex < len(flatBuffers); byteIndex++ {
+			_, _ = embeddedMetadataOf(flatBuffers[:byteIndex])
+			corrupted := append([]byte(nil), flatBuffers...)
+			corrupted[byteIndex] ^= 0xff
+			_, _ = embeddedMetadataOf(corrupted)
+		}
+
+		flatBuffers, err = encodeTableSet(tableSet, layout, nil, nil, nil, nil, nil, nil, !metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = MetadataFromFlatBuffers(flatBuffers)
+		if err == nil {
+			t.Errorf("%s: expecting an error from FlatBuffers without metadata", layout)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tableSet, err := gotables.NewTableSet("EncodeDecode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := gotables.NewTableFromMetadata("Events", []string{"id", "kind", "active", "timestamp", "score", "note"},
+		[]string{"int64", "string", "bool", "int32", "float64", "string"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough rows for more than one block of deltas, in key order.
+	const rowCount = 3*deltaBlockRows + 5
+	err = events.AppendRows(rowCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rowIndex := 0; rowIndex < rowCount; rowIndex++ {
+		var vals []interface{} = []interface{}{int64(rowIndex * rowIndex), []string{"open", "close"}[rowIndex%2],
+			rowIndex%7 < 3, int32(1000 + 10*rowIndex - rowIndex%3), float64(rowIndex) / 4, fmt.Sprintf("note %d", rowIndex)}
+		for colIndex, val := range vals {
+			err = events.SetValByColIndex(colIndex, rowIndex, val)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	empty, err := gotables.NewTableFromMetadata("Empty", []string{"x"}, []string{"uint16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []*gotables.Table{events, empty} {
+		err = tableSet.AppendTable(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var annotations string = strings.Join([]string{
+		"//flattables:key Events id",
+		"//flattables:index Events score",
+		"//flattables:dict Events kind",
+		"//flattables:encode Events delta id",
+		"//flattables:encode Events deltadelta timestamp",
+		"//flattables:encode Events rle active",
+		"//flattables:compress Events gzip",
+		"//flattables:checksum Events Empty",
+		"//flattables:metadata",
+	}, "\n")
+	fileName := t.TempDir() + "/tables.got"
+	err = ioutil.WriteFile(fileName, []byte(annotations+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, annotated := range []bool{false, true} {
+		if annotated {
+			tableSet.SetFileName(fileName)
+		}
+		flatBuffers, err := Encode(tableSet)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The embedded metadata has the annotations of the file, so it is schema enough to decode with.
+		var schemas []*gotables.TableSet = []*gotables.TableSet{tableSet}
+		if annotated {
+			metadata, err := embeddedMetadataOf(flatBuffers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			embeddedAnnotations, err := annotationsFromText(metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			declaredAnnotations, err := annotationsFromFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(embeddedAnnotations, declaredAnnotations) {
+				t.Errorf("embedded annotations %+v, expecting %+v", embeddedAnnotations, declaredAnnotations)
+			}
+
+			schema, err := MetadataFromFlatBuffers(flatBuffers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schemas = append(schemas, schema)
+		}
+
+		for schemaIndex, schema := range schemas {
+			decoded, err := Decode(flatBuffers, schema)
+			if err != nil {
+				t.Fatalf("annotated %t, schema %d: %v", annotated, schemaIndex, err)
+			}
+			if decoded.TableCount() != tableSet.TableCount() {
+				t.Fatalf("annotated %t, schema %d: decoded %d tables, expecting %d",
+					annotated, schemaIndex, decoded.TableCount(), tableSet.TableCount())
+			}
+			for tableIndex := 0; tableIndex < tableSet.TableCount(); tableIndex++ {
+				table, err := tableSet.TableByTableIndex(tableIndex)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decodedTable, err := decoded.TableByTableIndex(tableIndex)
+				if err != nil {
+					t.Fatal(err)
+				}
+				equals, err := decodedTable.Equals(table)
+				if !equals {
+					t.Errorf("annotated %t, schema %d: decoded table [%s] differs: %v", annotated, schemaIndex, table.Name(), err)
+				}
+			}
+		}
+
+		// No panic, whatever the bytes.
+		for byteIndex := 0; byteIndex < len(flatBuffers); byteIndex += 7 {
+			_, _ = Decode(flatBuffers[:byteIndex], tableSet)
+			corrupted := append([]byte(nil), flatBuffers...)
+			corrupted[byteIndex] ^= 0xff
+			_, _ = Decode(corrupted, tableSet)
+		}
+	}
+
+	// A change to the stored bytes of checksummed table Events.
+	flatBuffers, err := Encode(tableSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flatBuffers[len(flatBuffers)/3] ^= 0xff
+	_, err = Decode(flatBuffers, tableSet)
+	if corrupt, isCorrupt := err.(*CorruptTableError); !isCorrupt || corrupt.TableName != "Events" {
+		t.Errorf("expecting a *CorruptTableError of table [Events], not: %v", err)
+	}
+
+	_, err = Decode(flatBuffers, nil)
+	if err == nil {
+		t.Errorf("expecting an error from a <nil> schema")
+	}
+}
+
+/*
+TestDecodeEarlierFlatBuffers decodes FlatBuffers encoded with an earlier version of a gotables file, using the later
+version as the schema. A table appended since has no rows.
+*/
+func TestDecodeEarlierFlatBuffers(t *testing.T) {
+	// The table names and annotations of each version, and the error expected: A, A+ and B are tables of decodeTestTable().
+	var tests = []struct {
+		earlier []string
+		later   []string
+		err     string
+	}{
+		{ // Table B checksummed, then table A compressed.
+			[]string{"A", "B", "//flattables:checksum B"},
+			[]string{"A", "B", "//flattables:checksum B", "//flattables:compress A flate"},
+			"",
+		},
+		{ // Table A compressed and checksummed, then table B compressed.
+			[]string{"A", "B", "//flattables:compress A gzip", "//flattables:checksum A"},
+			[]string{"A", "B", "//flattables:compress A gzip", "//flattables:compress B flate", "//flattables:checksum A"},
+			"",
+		},
+		{ // Col s dictionary-encoded, then col x indexed.
+			[]string{"A", "//flattables:dict A s"},
+			[]string{"A", "//flattables:index A x", "//flattables:dict A s"},
+			"",
+		},
+		{ // Cols x and id delta and delta-of-delta encoded, then col s dictionary-encoded.
+			[]string{"A", "B", "//flattables:encode A delta x", "//flattables:encode B deltadelta id"},
+			[]string{"A", "B", "//flattables:encode A delta x", "//flattables:encode B deltadelta id", "//flattables:dict A s"},
+			"",
+		},
+		{ // Col s dictionary-encoded, then col x run-length encoded.
+			[]string{"A", "//flattables:dict A s"},
+			[]string{"A", "//flattables:dict A s", "//flattables:encode A rle x"},
+			"",
+		},
+		{ // Col x indexed and encoded and col s dictionary-encoded, then col y appended: its vector is missing, not misread.
+			[]string{"A", "//flattables:index A x", "//flattables:dict A s", "//flattables:encode A delta x"},
+			[]string{"A+", "//flattables:index A x", "//flattables:dict A s", "//flattables:encode A delta x"},
+			"[A] col y has 0 rows, expecting 3",
+		},
+	}
+
+	for i, test := range tests {
+		earlier, err := decodeTestTableSet(t, test.earlier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		later, err := decodeTestTableSet(t, test.later)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		flatBuffers, err := Encode(earlier)
+		if err != nil {
+			t.Fatalf("test[%d] %v", i, err)
+		}
+		decoded, err := Decode(flatBuffers, later)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test[%d] expecting error %q, not: %v", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		for tableIndex := 0; tableIndex < decoded.TableCount(); tableIndex++ {
+			decodedTable, err := decoded.TableByTableIndex(tableIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table, err := earlier.Table(decodedTable.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			equals, err := decodedTable.Equals(table)
+			if !equals {
+				t.Errorf("test[%d] decoded table [%s] differs: %v", i, table.Name(), err)
+			}
+		}
+	}
+}
+
+/*
+baselineFlatBuffers are FlatBuffers of tables A and B of decodeTestTable(), encoded by NewFlatBuffersFromTableSet()
+as flattablesc generated it before FlatTables had any field but the tables.
+*/
+var baselineFlatBuffers = []byte{
+	12, 0, 0, 0, 8, 0, 12, 0, 8, 0, 4, 0, 8, 0, 0, 0, 8, 0, 0, 0, 80, 0, 0, 0, 72, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0,
+	0, 8, 0, 12, 0, 8, 0, 4, 0, 8, 0, 0, 0, 8, 0, 0, 0, 28, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 224, 63, 0, 0,
+	0, 0, 0, 0, 244, 191, 0, 0, 0, 0, 2, 0, 0, 0, 10, 0, 0, 0, 0, 0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 80, 0, 0, 0,
+	12, 0, 0, 0, 8, 0, 12, 0, 8, 0, 4, 0, 8, 0, 0, 0, 8, 0, 0, 0, 44, 0, 0, 0, 3, 0, 0, 0, 28, 0, 0, 0, 16, 0, 0,
+	0, 4, 0, 0, 0, 1, 0, 0, 0, 99, 0, 0, 0, 1, 0, 0, 0, 97, 0, 0, 0, 1, 0, 0, 0, 99, 0, 0, 0, 3, 0, 0, 0, 3, 0, 0,
+	0, 1, 0, 0, 0, 2, 0, 0, 0,
+}
+
+func TestDecodeBaselineFlatBuffers(t *testing.T) {
+	// The table names and annotations of later versions of the gotables file of baselineFlatBuffers.
+	var tests = [][]string{
+		{"A", "B"},
+		{"A", "B", "C"},
+		{"A", "B", "//flattables:compress A flate", "//flattables:checksum B", "//flattables:metadata"},
+		{"A", "B", "C", "//flattables:index A x", "//flattables:dict A s", "//flattables:encode B delta id"},
+	}
+
+	earlier, err := decodeTestTableSet(t, []string{"A", "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range tests {
+		later, err := decodeTestTableSet(t, test)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := Decode(baselineFlatBuffers, later)
+		if err != nil {
+			t.Errorf("test[%d] %v", i, err)
+			continue
+		}
+
+		for tableIndex := 0; tableIndex < decoded.TableCount(); tableIndex++ {
+			decodedTable, err := decoded.TableByTableIndex(tableIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table, err := earlier.Table(decodedTable.Name())
+			if err != nil {
+				// Appended since.
+				if decodedTable.RowCount() != 0 {
+					t.Errorf("test[%d] appended table [%s] has %d rows, expecting 0", i, decodedTable.Name(), decodedTable.RowCount())
+				}
+				continue
+			}
+			equals, err := decodedTable.Equals(table)
+			if !equals {
+				t.Errorf("test[%d] decoded table [%s] differs: %v", i, table.Name(), err)
+			}
+		}
+	}
+}
+
+/*
+decodeTestTableSet() returns a TableSet of the tables of decodeTestTable() named in items, in order,
+annotated with the items that are annotations.
+*/
+func decodeTestTableSet(t *testing.T, items []string) (*gotables.TableSet, error) {
+	tableSet, err := gotables.NewTableSet("DecodeTest")
+	if err != nil {
+		return nil, err
+	}
+	var annotations []string
+	for _, item := range items {
+		if strings.HasPrefix(item, "//") {
+			annotations = append(annotations, item)
+			continue
+		}
+		table, err := decodeTestTable(item)
+		if err != nil {
+			return nil, err
+		}
+		err = tableSet.AppendTable(table)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fileName := t.TempDir() + "/tables.got"
+	err = ioutil.WriteFile(fileName, []byte(strings.Join(annotations, "\n")+"\n"), 0644)
+	if err != nil {
+		return nil, err
+	}
+	tableSet.SetFileName(fileName)
+
+	return tableSet, nil
+}
+
+/*
+decodeTestTable() returns table A, B or C of TestDecodeEarlierFlatBuffers() and TestDecodeBaselineFlatBuffers(),
+with rows. A+ is table A with col y appended.
+*/
+func decodeTestTable(tableName string) (*gotables.Table, error) {
+	var colNames []string
+	var colTypes []string
+	var rows [][]interface{}
+	switch tableName {
+	case "A":
+		colNames, colTypes = []string{"x", "s"}, []string{"int32", "string"}
+		rows = [][]interface{}{{int32(3), "c"}, {int32(1), "a"}, {int32(2), "c"}}
+	case "A+":
+		tableName = "A"
+		colNames, colTypes = []string{"x", "s", "y"}, []string{"int32", "string", "uint16"}
+		rows = [][]interface{}{{int32(3), "c", uint16(30)}, {int32(1), "a", uint16(10)}, {int32(2), "c", uint16(20)}}
+	case "B":
+		colNames, colTypes = []string{"id", "v"}, []string{"int64", "float64"}
+		rows = [][]interface{}{{int64(10), 0.5}, {int64(20), -1.25}}
+	case "C":
+		colNames, colTypes = []string{"n"}, []string{"uint8"}
+		rows = [][]interface{}{{uint8(7)}}
+	default:
+		return nil, fmt.Errorf("no test table [%s]", tableName)
+	}
+
+	table, err := gotables.NewTableFromMetadata(tableName, colNames, colTypes)
+	if err != nil {
+		return nil, err
+	}
+	err = table.AppendRows(len(rows))
+	if err != nil {
+		return nil, err
+	}
+	for rowIndex, row := range rows {
+		for colIndex, val := range row {
+			err = table.SetValByColIndex(colIndex, rowIndex, val)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return table, nil
+}
+
+func TestCompressTableBytes(t *testing.T) {
+	var tableBytes []byte = bytes.Repeat([]byte("FlatTables "), 1000)
+
+	for _, codec := range []string{CodecFlate, CodecGzip} {
+		compressed, err := compressTableBytes(codec, tableBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compressed) >= len(tableBytes)/10 {
+			t.Errorf("%s: expecting %d repetitive bytes to compress well, not to %d", codec, len(tableBytes), len(compressed))
+		}
+
+		var reader io.Reader
+		if codec == CodecGzip {
+			reader, err = gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			reader = flate.NewReader(bytes.NewReader(compressed))
+		}
+		decompressed, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed, tableBytes) {
+			t.Errorf("%s: decompressed bytes differ", codec)
+		}
+	}
+
+	_, err := compressTableBytes("zstd", tableBytes)
+	if err == nil {
+		t.Errorf("expecting an error from an unknown codec")
+	}
+}
+
+func TestSignFlatBuffers(t *testing.T) {
+	var flatBuffers []byte = bytes.Repeat([]byte("FlatTables "), 100)
+
+	hmacKey, err := NewHMACKey(bytes.Repeat([]byte("secret"), 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	ed25519Key, err := NewEd25519SigningKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyingKey, err := NewEd25519VerifyingKey(privateKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		signing       SigningKey
+		verifying     SigningKey
+		signatureSize int
+	}{
+		{hmacKey, hmacKey, sha256.Size},
+		{ed25519Key, verifyingKey, ed25519.SignatureSize},
+		{ed25519Key, ed25519Key, ed25519.SignatureSize},
+	}
+
+	for i, test := range tests {
+		envelope, err := SignFlatBuffers(flatBuffers, test.signing)
+		if err != nil {
+			t.Fatalf("test[%d] %v", i, err)
+		}
+		if len(envelope) != len(flatBuffers)+test.signatureSize+signatureTrailerSize {
+			t.Errorf("test[%d] envelope of %d bytes, expecting %d", i, len(envelope), len(flatBuffers)+test.signatureSize+signatureTrailerSize)
+		}
+
+		verified, err := VerifySignedFlatBuffers(envelope, test.verifying)
+		if err != nil {
+			t.Fatalf("test[%d] %v", i, err)
+		}
+		if !bytes.Equal(verified, flatBuffers) {
+			t.Errorf("test[%d] VerifySignedFlatBuffers() != the FlatBuffers signed", i)
+		}
+		if cap(verified) != len(verified) {
+			t.Errorf("test[%d] VerifySignedFlatBuffers() capacity %d reaches past its %d bytes", i, cap(verified), len(verified))
+		}
+
+		for byteIndex := 0; byteIndex < len(envelope); byteIndex += 7 {
+			tampered := append([]byte(nil), envelope...)
+			tampered[byteIndex] ^= 0x80
+			if _, err := VerifySignedFlatBuffers(tampered, test.verifying); err == nil {
+				t.Errorf("test[%d] expecting an error from an envelope tampered with at byte %d", i, byteIndex)
+			}
+		}
+		if _, err := VerifySignedFlatBuffers(flatBuffers, test.verifying); err == nil {
+			t.Errorf("test[%d] expecting an error from unsigned FlatBuffers", i)
+		}
+	}
+
+	envelope, err := SignFlatBuffers(flatBuffers, hmacKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySignedFlatBuffers(envelope, verifyingKey); err == nil {
+		t.Errorf("expecting an error from verifying an HMAC signature with an Ed25519 key")
+	}
+	if _, err := SignFlatBuffers(flatBuffers, verifyingKey); err == nil {
+		t.Errorf("expecting an error from signing with an Ed25519 verifying key")
+	}
+	if _, err := SignFlatBuffers(flatBuffers, SigningKey{}); err == nil {
+		t.Errorf("expecting an error from signing with the zero SigningKey")
+	}
+	if _, err := NewHMACKey([]byte("short")); err == nil {
+		t.Errorf("expecting an error from a short HMAC secret")
+	}
+}
+
+func TestSetIndexCols(t *testing.T) {
+	tableInfo := TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "orderId"}, {ColName: "region"}, {ColName: "status"}}}
+
+	err := setIndexCols(&tableInfo, []string{"status", "region"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tableInfo.IndexCols) != 2 || tableInfo.IndexCols[0].ColName != "status" || !tableInfo.Cols[1].IsIndexed || tableInfo.Cols[0].IsIndexed {
+		t.Errorf("unexpected index cols %v of cols %v", tableInfo.IndexCols, tableInfo.Cols)
+	}
+
+	for _, indexColNames := range [][]string{{"missing"}, {"qty", "qty"}, {"old"}, {"region"}} {
+		tableInfo := TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "qty"}, {ColName: "old", IsDeprecated: true}, {ColName: "region"}, {ColName: "regionIndex"}}}
+		err = setIndexCols(&tableInfo, indexColNames)
+		if err == nil {
+			t.Errorf("expecting an error from index cols %v", indexColNames)
+		}
+	}
+}
+
+func TestSetDictCols(t *testing.T) {
+	tableInfo := TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "orderId", IsScalar: true}, {ColName: "region", IsString: true}, {ColName: "status", IsString: true}}}
+
+	err := setDictCols(&tableInfo, []string{"status", "region"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tableInfo.DictCols) != 2 || tableInfo.DictCols[0].ColName != "status" || !tableInfo.Cols[1].IsDict || tableInfo.Cols[0].IsDict {
+		t.Errorf("unexpected dict cols %v of cols %v", tableInfo.DictCols, tableInfo.Cols)
+	}
+
+	for _, dictColNames := range [][]string{{"missing"}, {"region", "region"}, {"old"}, {"qty"}, {"status"}} {
+		tableInfo := TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "qty", IsScalar: true}, {ColName: "old", IsString: true, IsDeprecated: true},
+			{ColName: "region", IsString: true}, {ColName: "status", IsString: true}, {ColName: "statusCodes16", IsString: true}}}
+		err = setDictCols(&tableInfo, dictColNames)
+		if err == nil {
+			t.Errorf("expecting an error from dict cols %v", dictColNames)
+		}
+	}
+}
+
+func TestSetEncodedCols(t *testing.T) {
+	tableInfo := TableInfo{TableName: "Events", Cols: []ColInfo{{ColName: "seq", ColType: "int32", IsScalar: true},
+		{ColName: "name", ColType: "string", IsString: true}, {ColName: "active", ColType: "bool", IsScalar: true, IsBool: true}}}
+
+	err := setEncodedCols(&tableInfo, map[string]string{"active": EncodingRunLength, "seq": EncodingDelta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tableInfo.EncodedCols) != 2 || tableInfo.EncodedCols[0].ColName != "seq" || tableInfo.Cols[1].Encoding != "" ||
+		tableInfo.Cols[2].Encoding != EncodingRunLength || !reflect.DeepEqual(tableInfo.Cols[0].DeltaBits, []int{8, 16, 32}) {
+		t.Errorf("unexpected encoded cols %v of cols %v", tableInfo.EncodedCols, tableInfo.Cols)
+	}
+
+	for _, encodings := range []map[string]string{{"missing": EncodingDelta}, {"name": EncodingRunLength}, {"active": EncodingDelta},
+		{"score": EncodingDelta}, {"old": EncodingRunLength}, {"seq": EncodingDeltaOfDelta}} {
+		tableInfo := TableInfo{TableName: "Events", Cols: []ColInfo{{ColName: "seq", ColType: "int64", IsScalar: true},
+			{ColName: "name", ColType: "string", IsString: true}, {ColName: "active", ColType: "bool", IsScalar: true, IsBool: true},
+			{ColName: "score", ColType: "float64", IsScalar: true}, {ColName: "old", ColType: "int8", IsScalar: true, IsDeprecated: true},
+			{ColName: "seqDeltaDelta16", ColType: "int16", IsScalar: true}}}
+		err = setEncodedCols(&tableInfo, encodings)
+		if err == nil {
+			t.Errorf("expecting an error from encodings %v", encodings)
+		}
+	}
+}
+
+func TestSetReserved(t *testing.T) {
+	tableInfo := TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "orderId"}, {ColName: "region"}}}
+	err := setReserved(&tableInfo)
+	if err != nil || tableInfo.Reserved != nil {
+		t.Errorf("unexpected reserved slots %v of a table with no col fields: %v", tableInfo.Reserved, err)
+	}
+
+	tableInfo.IndexCols = tableInfo.Cols[1:]
+	err = setReserved(&tableInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tableInfo.Reserved) != colFieldsStartSlot-2 || tableInfo.Reserved[0] != 2 || tableInfo.Reserved[len(tableInfo.Reserved)-1] != colFieldsStartSlot-1 {
+		t.Errorf("unexpected reserved slots %v", tableInfo.Reserved)
+	}
+
+	tableInfo = TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "orderId"}, {ColName: "slot2_reserved"}}}
+	tableInfo.DictCols = tableInfo.Cols[:1]
+	if err = setReserved(&tableInfo); err == nil {
+		t.Errorf("expecting an error from a col named as a placeholder")
+	}
+	tableInfo = TableInfo{TableName: "Orders", Cols: make([]ColInfo, colFieldsStartSlot+1)}
+	tableInfo.EncodedCols = tableInfo.Cols[:1]
+	if err = setReserved(&tableInfo); err == nil {
+		t.Errorf("expecting an error from %d cols with col fields", len(tableInfo.Cols))
+	}
+}
+
+func TestEncodeDelta(t *testing.T) {
+	// Timestamps a second apart, with a jitter: delta-of-delta needs fewer bits than delta.
+	var values []int64
+	for rowIndex := 0; rowIndex < 300; rowIndex++ {
+		values = append(values, 1500000000000+int64(rowIndex)*1000+int64(rowIndex%3))
+	}
+	heads, deltas, deltaBits := encodeDelta(values, 64, false)
+	if len(heads) != 3 || heads[1] != values[deltaBlockRows] || len(deltas) != len(values) || deltaBits != 16 {
+		t.Fatalf("unexpected heads %v of %d deltas of %d bits", heads, len(deltas), deltaBits)
+	}
+	heads, deltas, deltaBits = encodeDelta(values, 64, true)
+	if len(heads) != 6 || heads[2] != values[deltaBlockRows] || heads[3] != values[deltaBlockRows+1]-values[deltaBlockRows] || deltaBits != 8 {
+		t.Fatalf("unexpected heads %v of %d deltas of deltas of %d bits", heads, len(deltas), deltaBits)
+	}
+
+	// Decoded block by block, in the arithmetic of the col type, as the generated accessors do.
+	for _, ofDelta := range []bool{false, true} {
+		for _, colValues := range [][]int64{values, {-128, 127, -128, 0, 127}, {math.MinInt64, math.MaxInt64, 0, math.MinInt64}} {
+			var colBits int = 64
+			if colValues[0] == -128 {
+				colBits = 8
+			}
+			heads, entries, _ := encodeDelta(colValues, colBits, ofDelta)
+			var value, delta int64
+			for rowIndex, entry := range entries {
+				if rowIndex%deltaBlockRows == 0 && ofDelta {
+					value, delta = heads[2*(rowIndex/deltaBlockRows)], heads[2*(rowIndex/deltaBlockRows)+1]
+				} else if rowIndex%deltaBlockRows == 0 {
+					value = heads[rowIndex/deltaBlockRows]
+				} else if ofDelta {
+					delta = signExtend(delta+entry, colBits)
+					value = signExtend(value+delta, colBits)
+				} else {
+					value = signExtend(value+entry, colBits)
+				}
+				if value != colValues[rowIndex] {
+					t.Errorf("ofDelta %t: row %d decodes to %d, not %d", ofDelta, rowIndex, value, colValues[rowIndex])
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeRunLength(t *testing.T) {
+	heads, runEnds := encodeRunLength([]int64{1, 1, 1, 0, 0, 1, 7})
+	if !reflect.DeepEqual(heads, []int64{1, 0, 1, 7}) || !reflect.DeepEqual(runEnds, []int64{3, 5, 6, 7}) {
+		t.Errorf("unexpected runs %v ending at %v", heads, runEnds)
+	}
+	heads, runEnds = encodeRunLength(nil)
+	if len(heads) != 0 || len(runEnds) != 0 {
+		t.Errorf("unexpected runs %v ending at %v of no values", heads, runEnds)
+	}
+}
+
+func TestSetKeyCols(t *testing.T) {
+	tableInfo := TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "orderId"}, {ColName: "region"}, {ColName: "qty"}}}
+
+	err := setKeyCols(&tableInfo, []string{"region", "orderId"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tableInfo.KeyName != "RegionOrderId" {
+		t.Errorf("expecting KeyName RegionOrderId, not %s", tableInfo.KeyName)
+	}
+	if len(tableInfo.KeyCols) != 2 || tableInfo.KeyCols[0].ColName != "region" || !tableInfo.Cols[0].IsKey || tableInfo.Cols[2].IsKey {
+		t.Errorf("unexpected key cols %v of cols %v", tableInfo.KeyCols, tableInfo.Cols)
+	}
+
+	for _, keyColNames := range [][]string{{"missing"}, {"qty", "qty"}} {
+		tableInfo := TableInfo{TableName: "Orders", Cols: []ColInfo{{ColName: "orderId"}, {ColName: "qty"}}}
+		err = setKeyCols(&tableInfo, keyColNames)
+		if err == nil {
+			t.Errorf("expecting an error from key cols %v", keyColNames)
+		}
+	}
+}
+
+func TestSortedRowIndexes(t *testing.T) {
+	table, err := gotables.NewTableFromMetadata("Orders", []string{"region", "score", "orderId"}, []string{"string", "float64", "int32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows = []struct {
+		region  string
+		score   float64
+		orderId int32
+	}{{"y", 1, 0}, {"x", math.NaN(), 1}, {"y", 1, 2}, {"", 2, 3}, {"y", math.NaN(), 4}, {"x", -1, 5}}
+	for rowIndex, row := range rows {
+		err = table.AppendRow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = table.SetString("region", rowIndex, row.region)
+		_ = table.SetFloat64("score", rowIndex, row.score)
+		_ = table.SetInt32("orderId", rowIndex, row.orderId)
+	}
+
+	rowIndexes, err := sortedRowIndexes(table, []string{"region", "score"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NaN is first, and rows with equal keys keep their order.
+	if expecting := []int{3, 1, 5, 4, 0, 2}; !reflect.DeepEqual(rowIndexes, expecting) {
+		t.Errorf("expecting row indexes %v, not %v", expecting, rowIndexes)
+	}
+
+	rowIndexes, err = sortedRowIndexes(table, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expecting := []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(rowIndexes, expecting) {
+		t.Errorf("expecting row indexes %v without key cols, not %v", expecting, rowIndexes)
+	}
+
+	_, err = sortedRowIndexes(table, []string{"missing"})
+	if err == nil {
+		t.Errorf("expecting an error from missing key col")
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	for _, distinctCount := range []int{0, 1, 10, 1000, 100000} {
+		var hll hyperLogLog
+		for i := 0; i < 2*distinctCount; i++ {
+			hll.add(hashString(fmt.Sprintf("value %d", i%distinctCount))) // Each value twice.
+		}
+
+		var estimate float64 = float64(hll.estimate())
+		var tolerance float64 = 0.1*float64(distinctCount) + 0.5
+		if math.Abs(estimate-float64(distinctCount)) > tolerance {
+			t.Errorf("expecting a distinct estimate of %d +/- %.1f, not %.0f", distinctCount, tolerance, estimate)
+		}
+	}
+
+	var positiveZero hyperLogLog
+	positiveZero.add(hashFloat64(0))
+	var negativeZero hyperLogLog
+	negativeZero.add(hashFloat64(math.Copysign(0, -1)))
+	if positiveZero != negativeZero {
+		t.Errorf("expecting -0 and +0 to hash the same")
+	}
+}
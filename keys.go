@@ -0,0 +1,785 @@
+package flattables
+
+// Key cols, secondary indexes, dictionary-encoded cols, encoded numeric cols, compression and checksums of tables,
+// and embedded metadata, declared by annotations in the gotables file.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urban-wombat/gotables"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+KeyAnnotation declares the key cols of a table in a gotables file, on a line of its own (anywhere in the file):-
+
+	//flattables:key <TableName> <colName> [<colName> ...]
+
+For example:-
+
+	//flattables:key Users id
+	//flattables:key Orders region orderId
+
+The key cols identify a row, so flattablesc generates key-based code (such as MergeOrdersByRegionOrderId()
+and LookupOrdersByRegionOrderId()) for the table. The encoders write its rows sorted by key.
+gotables reads the line as a comment, so the file is still a valid gotables file.
+*/
+const KeyAnnotation = "//flattables:key"
+
+/*
+IndexAnnotation declares secondary indexes of a table in a gotables file, on a line of its own (anywhere in the file):-
+
+	//flattables:index <TableName> <colName> [<colName> ...]
+
+For example:-
+
+	//flattables:index Orders status region
+
+Each col named has an index of its own: a vector of the row indexes of the table in order of the col, which the
+encoders store in the FlatBuffers next to the col vectors (as field <colName>Index). flattablesc generates
+<TableName>RowsBy<ColName>() and <TableName>RowsBy<ColName>Range(), which find rows by binary search of the index.
+A table may have more than one such line.
+*/
+const IndexAnnotation = "//flattables:index"
+
+// The suffix of the field of the index of a col. See IndexAnnotation.
+const indexSuffix = "Index"
+
+// The name of the placeholder field at a Reserved slot of a table, as the schema declares it.
+const reservedColSlotFormat = "slot%d_reserved"
+
+/*
+DictAnnotation declares dictionary-encoded string cols of a table in a gotables file, on a line of its own (anywhere in the file):-
+
+	//flattables:dict <TableName> <colName> [<colName> ...]
+
+For example:-
+
+	//flattables:dict Orders status country
+
+Instead of a string per row, the encoders store the distinct values of each col named (in order of first row)
+as vector field <colName>Dict, and a code per row (the position of its value in <colName>Dict) as vector field
+<colName>Codes8, <colName>Codes16 or <colName>Codes32: the smallest that fits the number of distinct values.
+flattablesc generates the <ColName>() and <ColName>Length() accessors that flatc would have, so readers see plain
+strings. It suits cols with few distinct values, such as country codes or statuses. A table may have more than one such line.
+*/
+const DictAnnotation = "//flattables:dict"
+
+// The suffixes of the fields of a dictionary-encoded col. See DictAnnotation.
+const (
+	dictSuffix    = "Dict"
+	codes8Suffix  = "Codes8"
+	codes16Suffix = "Codes16"
+	codes32Suffix = "Codes32"
+)
+
+/*
+EncodeAnnotation declares numeric cols of a table that are stored encoded, on a line of its own (anywhere in the file):-
+
+	//flattables:encode <TableName> <encoding> <colName> [<colName> ...]
+
+where <encoding> is one of:-
+
+	EncodingDelta        (delta)       Each row stores the difference from the row before. Suits sorted ids and timestamps.
+	EncodingDeltaOfDelta (deltadelta)  Each row stores the difference of its delta from the delta before. Suits regular timestamps.
+	EncodingRunLength    (rle)         Each run of equal values is stored once, with the row it ends at. Suits repetitive flags.
+
+For example:-
+
+	//flattables:encode Events delta seq
+	//flattables:encode Events deltadelta timestamp
+	//flattables:encode Events rle active
+
+Delta and delta-of-delta need an integer col. They restart every deltaBlockRows rows, at a value stored in field
+<colName>Values (delta-of-delta also stores the delta to the next row there), and store the differences in the smallest of the vectors <colName>Delta8 ... <colName>Delta64
+(or <colName>DeltaDelta8 ...) that fits them all, so a cell is decoded from at most deltaBlockRows differences.
+Run-length needs an integer or bool col. It stores the value of each run in <colName>Values, and the end row of each
+run (exclusive) in <colName>RunEnds, so a cell is found by binary search.
+flattablesc generates the <ColName>() and <ColName>Length() accessors that flatc would have, and <ColName>Iterator()
+for fast sequential reading. FlatBuffers encoded before a col was encoded have only <colName>Values: they are read as before.
+A table may have more than one such line.
+*/
+const EncodeAnnotation = "//flattables:encode"
+
+// The encodings of EncodeAnnotation.
+const (
+	EncodingDelta        = "delta"
+	EncodingDeltaOfDelta = "deltadelta"
+	EncodingRunLength    = "rle"
+)
+
+// The suffixes of the fields of an encoded col. See EncodeAnnotation.
+const (
+	valuesSuffix       = "Values"
+	deltaSuffix        = "Delta"
+	deltaOfDeltaSuffix = "DeltaDelta"
+	runEndsSuffix      = "RunEnds"
+)
+
+// The rows of each block of a delta or delta-of-delta encoded col, which starts at a value stored in <colName>Values.
+const deltaBlockRows = 128
+
+/*
+CompressAnnotation declares that a table is stored compressed in FlatTables, on a line of its own (anywhere in the file):-
+
+	//flattables:compress <TableName> <codec>
+
+where <codec> is CodecFlate (compress/flate) or CodecGzip (compress/gzip). For example:-
+
+	//flattables:compress OrderHistory flate
+
+The encoders compress the nested FlatBuffers bytes of the table, and FlatTables records the codec and the
+uncompressed size (as fields <TableName>Codec and <TableName>Size). The decoders decompress the table
+transparently. The other tables stay uncompressed, and are read in place as before.
+Compression needs layout NestedLayout: in SingleLayout there are no nested bytes to compress.
+*/
+const CompressAnnotation = "//flattables:compress"
+
+// The codecs of CompressAnnotation.
+const (
+	CodecFlate = "flate"
+	CodecGzip  = "gzip"
+)
+
+// The value stored in FlatTables as <TableName>Codec for each codec. Zero (the default) is uncompressed.
+var codecValues = map[string]byte{
+	CodecFlate: 1,
+	CodecGzip:  2,
+}
+
+/*
+ChecksumAnnotation declares tables whose bytes FlatTables records a checksum of, on a line of its own (anywhere in the file):-
+
+	//flattables:checksum <TableName> [<TableName> ...]
+
+For example:-
+
+	//flattables:checksum Orders OrderHistory
+
+The encoders record a CRC32-C (hash/crc32 with the Castagnoli polynomial) of the nested FlatBuffers bytes of each
+table as FlatTables stores them (after any compression: see CompressAnnotation), as field <TableName>Checksum.
+The decoders check it for each table they read, and return a *CorruptTableError naming a table that doesn't match.
+A checksum of zero is not checked, so FlatBuffers encoded before the annotation was added can still be read.
+Checksums need layout NestedLayout: in SingleLayout there are no nested bytes to checksum.
+*/
+const ChecksumAnnotation = "//flattables:checksum"
+
+/*
+MetadataAnnotation declares that FlatTables embeds the gotables metadata of its tables, on a line of its own
+(anywhere in the file):-
+
+	//flattables:metadata
+
+The encoders store the metadata (the tables of the gotables file with no rows, in struct shape, as gotables text)
+in FlatTables as field TableSetMetadata, after a first line of MetadataAnnotation and a line of each of the other
+annotations of the file. The FlatBuffers are then self-describing: MetadataFromFlatBuffers() returns the table and
+col names and types from the FlatBuffers alone, without the generated package, and Decode() with them as the schema
+reads the rows. TableSetMetadata is the last field of FlatTables.
+*/
+const MetadataAnnotation = "//flattables:metadata"
+
+// fileAnnotations are the annotations declared in a gotables file, as the encoders and decoders of the library use them.
+type fileAnnotations struct {
+	keys      map[string][]string          // See KeyAnnotation.
+	indexes   map[string][]string          // See IndexAnnotation.
+	dicts     map[string][]string          // See DictAnnotation.
+	encodings map[string]map[string]string // See EncodeAnnotation.
+	codecs    map[string]string            // See CompressAnnotation.
+	checksums map[string]bool              // See ChecksumAnnotation.
+	metadata  bool                         // See MetadataAnnotation.
+}
+
+// annotationsFromFile() returns the annotations declared in gotables file fileName, or none if fileName is "".
+func annotationsFromFile(fileName string) (annotations fileAnnotations, err error) {
+	if fileName == "" {
+		return annotations, nil
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return annotations, err
+	}
+	defer file.Close()
+
+	annotations, err = annotationsFromScanner(bufio.NewScanner(file))
+	if err != nil {
+		return annotations, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	return annotations, nil
+}
+
+// annotationsFromText() returns the annotations declared in the lines of text, such as metadata that FlatTables embeds.
+func annotationsFromText(text string) (annotations fileAnnotations, err error) {
+	return annotationsFromScanner(bufio.NewScanner(strings.NewReader(text)))
+}
+
+/*
+annotationsFromScanner() returns the annotations declared in the lines of scanner, in one pass: each line that starts
+with an annotation is parsed according to its kind. Other lines (including unknown //flattables: lines) are skipped.
+*/
+func annotationsFromScanner(scanner *bufio.Scanner) (annotations fileAnnotations, err error) {
+	annotations = fileAnnotations{
+		keys:      make(map[string][]string),
+		indexes:   make(map[string][]string),
+		dicts:     make(map[string][]string),
+		encodings: make(map[string]map[string]string),
+		codecs:    make(map[string]string),
+		checksums: make(map[string]bool),
+	}
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var fields []string = strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case KeyAnnotation:
+			err = addAnnotatedCols(annotations.keys, fields, false)
+		case IndexAnnotation:
+			err = addAnnotatedCols(annotations.indexes, fields, true)
+		case DictAnnotation:
+			err = addAnnotatedCols(annotations.dicts, fields, true)
+		case EncodeAnnotation:
+			err = addEncodings(annotations.encodings, fields)
+		case CompressAnnotation:
+			err = addCodec(annotations.codecs, fields)
+		case ChecksumAnnotation:
+			err = addChecksums(annotations.checksums, fields)
+		case MetadataAnnotation:
+			if len(fields) != 1 {
+				err = fmt.Errorf("expecting %s on its own", MetadataAnnotation)
+			} else if annotations.metadata {
+				err = fmt.Errorf("%s is already declared", MetadataAnnotation)
+			}
+			annotations.metadata = true
+		}
+		if err != nil {
+			return fileAnnotations{}, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fileAnnotations{}, err
+	}
+
+	return annotations, nil
+}
+
+/*
+annotationLines() returns annotations as lines of a gotables file, other than MetadataAnnotation, in a fixed order:
+by annotation, then by table name (and encoding). annotationsFromText() of the lines returns the same annotations.
+*/
+func annotationLines(annotations fileAnnotations) (lines []string) {
+	colLines := func(annotation string, cols map[string][]string) {
+		var tableNames []string
+		for tableName := range cols {
+			tableNames = append(tableNames, tableName)
+		}
+		sort.Strings(tableNames)
+		for _, tableName := range tableNames {
+			lines = append(lines, annotation+" "+tableName+" "+strings.Join(cols[tableName], " "))
+		}
+	}
+	colLines(KeyAnnotation, annotations.keys)
+	colLines(IndexAnnotation, annotations.indexes)
+	colLines(DictAnnotation, annotations.dicts)
+
+	// Each encoding of a table on a line of its own, with its cols in name order.
+	var encodings map[string][]string = make(map[string][]string)
+	for tableName, colEncodings := range annotations.encodings {
+		for colName, encoding := range colEncodings {
+			encodings[tableName+" "+encoding] = append(encodings[tableName+" "+encoding], colName)
+		}
+	}
+	for _, colNames := range encodings {
+		sort.Strings(colNames)
+	}
+	colLines(EncodeAnnotation, encodings)
+
+	var codecs map[string][]string = make(map[string][]string)
+	for tableName, codec := range annotations.codecs {
+		codecs[tableName] = []string{codec}
+	}
+	colLines(CompressAnnotation, codecs)
+
+	var checksummed []string
+	for tableName, checksum := range annotations.checksums {
+		if checksum {
+			checksummed = append(checksummed, tableName)
+		}
+	}
+	if len(checksummed) > 0 {
+		sort.Strings(checksummed)
+		lines = append(lines, ChecksumAnnotation+" "+strings.Join(checksummed, " "))
+	}
+
+	return lines
+}
+
+// keysFromText() returns the key col names of each table declared in the lines of scanner. See KeyAnnotation.
+func keysFromText(scanner *bufio.Scanner) (keys map[string][]string, err error) {
+	annotations, err := annotationsFromScanner(scanner)
+	return annotations.keys, err
+}
+
+// indexesFromText() returns the indexed col names of each table declared in the lines of scanner. See IndexAnnotation.
+func indexesFromText(scanner *bufio.Scanner) (indexes map[string][]string, err error) {
+	annotations, err := annotationsFromScanner(scanner)
+	return annotations.indexes, err
+}
+
+// dictsFromText() returns the dictionary-encoded col names of each table declared in the lines of scanner. See DictAnnotation.
+func dictsFromText(scanner *bufio.Scanner) (dicts map[string][]string, err error) {
+	annotations, err := annotationsFromScanner(scanner)
+	return annotations.dicts, err
+}
+
+// encodingsFromText() returns the encoding of each encoded col of each table declared in the lines of scanner. See EncodeAnnotation.
+func encodingsFromText(scanner *bufio.Scanner) (encodings map[string]map[string]string, err error) {
+	annotations, err := annotationsFromScanner(scanner)
+	return annotations.encodings, err
+}
+
+// codecsFromText() returns the codec of each table declared compressed in the lines of scanner. See CompressAnnotation.
+func codecsFromText(scanner *bufio.Scanner) (codecs map[string]string, err error) {
+	annotations, err := annotationsFromScanner(scanner)
+	return annotations.codecs, err
+}
+
+// checksumsFromText() returns the names of the tables declared checksummed in the lines of scanner. See ChecksumAnnotation.
+func checksumsFromText(scanner *bufio.Scanner) (checksums map[string]bool, err error) {
+	annotations, err := annotationsFromScanner(scanner)
+	return annotations.checksums, err
+}
+
+// metadataFromText() returns whether the lines of scanner declare MetadataAnnotation.
+func metadataFromText(scanner *bufio.Scanner) (metadata bool, err error) {
+	annotations, err := annotationsFromScanner(scanner)
+	return annotations.metadata, err
+}
+
+/*
+addAnnotatedCols() adds to cols the col names of the table declared by the fields of an annotation line
+(the annotation, the table name, then the col names). If repeatable, the cols of a table may be declared on
+more than one line, and are appended in order.
+*/
+func addAnnotatedCols(cols map[string][]string, fields []string, repeatable bool) error {
+	var annotation string = fields[0]
+	if len(fields) < 3 {
+		return fmt.Errorf("expecting %s <TableName> <colName> [<colName> ...]", annotation)
+	}
+
+	var tableName string = fields[1]
+	if _, exists := cols[tableName]; exists && !repeatable {
+		return fmt.Errorf("table [%s] already has a %s", tableName, annotation)
+	}
+	cols[tableName] = append(cols[tableName], fields[2:]...)
+
+	return nil
+}
+
+// addEncodings() adds to encodings the encoded cols declared by the fields of an EncodeAnnotation line.
+func addEncodings(encodings map[string]map[string]string, fields []string) error {
+	if len(fields) < 4 {
+		return fmt.Errorf("expecting %s <TableName> <encoding> <colName> [<colName> ...]", EncodeAnnotation)
+	}
+
+	var tableName string = fields[1]
+	var encoding string = fields[2]
+	switch encoding {
+	case EncodingDelta, EncodingDeltaOfDelta, EncodingRunLength:
+	default:
+		return fmt.Errorf("%s [%s]: unknown encoding %q (expecting %s, %s or %s)",
+			EncodeAnnotation, tableName, encoding, EncodingDelta, EncodingDeltaOfDelta, EncodingRunLength)
+	}
+
+	if _, exists := encodings[tableName]; !exists {
+		encodings[tableName] = make(map[string]string)
+	}
+	for _, colName := range fields[3:] {
+		if _, exists := encodings[tableName][colName]; exists {
+			return fmt.Errorf("%s [%s] col %s is already encoded", EncodeAnnotation, tableName, colName)
+		}
+		encodings[tableName][colName] = encoding
+	}
+
+	return nil
+}
+
+// addCodec() adds to codecs the codec of the table declared by the fields of a CompressAnnotation line.
+func addCodec(codecs map[string]string, fields []string) error {
+	if len(fields) < 3 {
+		return fmt.Errorf("expecting %s <TableName> <codec>", CompressAnnotation)
+	}
+
+	var tableName string = fields[1]
+	if len(fields) != 3 {
+		return fmt.Errorf("%s [%s]: expecting one codec, not %d", CompressAnnotation, tableName, len(fields)-2)
+	}
+	if _, exists := codecs[tableName]; exists {
+		return fmt.Errorf("table [%s] already has a %s", tableName, CompressAnnotation)
+	}
+	var codec string = fields[2]
+	if _, exists := codecValues[codec]; !exists {
+		return fmt.Errorf("%s [%s]: unknown codec %q (expecting %s or %s)", CompressAnnotation, tableName, codec, CodecFlate, CodecGzip)
+	}
+	codecs[tableName] = codec
+
+	return nil
+}
+
+// addChecksums() adds to checksums the tables declared by the fields of a ChecksumAnnotation line.
+func addChecksums(checksums map[string]bool, fields []string) error {
+	var tableNames []string = fields[1:]
+	if len(tableNames) == 0 {
+		return fmt.Errorf("expecting %s <TableName> [<TableName> ...]", ChecksumAnnotation)
+	}
+
+	for _, tableName := range tableNames {
+		if checksums[tableName] {
+			return fmt.Errorf("table [%s] already has a %s", tableName, ChecksumAnnotation)
+		}
+		checksums[tableName] = true
+	}
+
+	return nil
+}
+
+// setKeyCols() marks the key cols of tableInfo (in key order), and sets its KeyCols and KeyName.
+func setKeyCols(tableInfo *TableInfo, keyColNames []string) error {
+	for _, keyColName := range keyColNames {
+		var found bool
+		for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+			if tableInfo.Cols[colIndex].ColName != keyColName {
+				continue
+			}
+			if tableInfo.Cols[colIndex].IsKey {
+				return fmt.Errorf("%s [%s] has col %s more than once", KeyAnnotation, tableInfo.TableName, keyColName)
+			}
+			tableInfo.Cols[colIndex].IsKey = true
+			tableInfo.KeyCols = append(tableInfo.KeyCols, tableInfo.Cols[colIndex])
+			tableInfo.KeyName += firstCharToUpper(keyColName)
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("%s [%s] has no col %s", KeyAnnotation, tableInfo.TableName, keyColName)
+		}
+	}
+
+	return nil
+}
+
+// setIndexCols() marks the indexed cols of tableInfo (in declared order), and sets its IndexCols.
+func setIndexCols(tableInfo *TableInfo, indexColNames []string) error {
+	for _, indexColName := range indexColNames {
+		var found bool
+		for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+			if tableInfo.Cols[colIndex].ColName == indexColName+indexSuffix {
+				return fmt.Errorf("%s [%s] col %s: the index field name %s is the name of a col",
+					IndexAnnotation, tableInfo.TableName, indexColName, indexColName+indexSuffix)
+			}
+		}
+		for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+			if tableInfo.Cols[colIndex].ColName != indexColName {
+				continue
+			}
+			if tableInfo.Cols[colIndex].IsIndexed {
+				return fmt.Errorf("%s [%s] has col %s more than once", IndexAnnotation, tableInfo.TableName, indexColName)
+			}
+			if tableInfo.Cols[colIndex].IsDeprecated {
+				return fmt.Errorf("%s [%s] col %s is deprecated", IndexAnnotation, tableInfo.TableName, indexColName)
+			}
+			tableInfo.Cols[colIndex].IsIndexed = true
+			tableInfo.IndexCols = append(tableInfo.IndexCols, tableInfo.Cols[colIndex])
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("%s [%s] has no col %s", IndexAnnotation, tableInfo.TableName, indexColName)
+		}
+	}
+
+	return nil
+}
+
+// setDictCols() marks the dictionary-encoded cols of tableInfo (in declared order), and sets its DictCols.
+func setDictCols(tableInfo *TableInfo, dictColNames []string) error {
+	for _, dictColName := range dictColNames {
+		for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+			for _, suffix := range []string{dictSuffix, codes8Suffix, codes16Suffix, codes32Suffix} {
+				if tableInfo.Cols[colIndex].ColName == dictColName+suffix {
+					return fmt.Errorf("%s [%s] col %s: the dictionary field name %s is the name of a col",
+						DictAnnotation, tableInfo.TableName, dictColName, dictColName+suffix)
+				}
+			}
+		}
+		var found bool
+		for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+			if tableInfo.Cols[colIndex].ColName != dictColName {
+				continue
+			}
+			if tableInfo.Cols[colIndex].IsDict {
+				return fmt.Errorf("%s [%s] has col %s more than once", DictAnnotation, tableInfo.TableName, dictColName)
+			}
+			if tableInfo.Cols[colIndex].IsDeprecated {
+				return fmt.Errorf("%s [%s] col %s is deprecated", DictAnnotation, tableInfo.TableName, dictColName)
+			}
+			if !tableInfo.Cols[colIndex].IsString {
+				return fmt.Errorf("%s [%s] col %s is type %s, not string",
+					DictAnnotation, tableInfo.TableName, dictColName, tableInfo.Cols[colIndex].ColType)
+			}
+			tableInfo.Cols[colIndex].IsDict = true
+			tableInfo.DictCols = append(tableInfo.DictCols, tableInfo.Cols[colIndex])
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("%s [%s] has no col %s", DictAnnotation, tableInfo.TableName, dictColName)
+		}
+	}
+
+	return nil
+}
+
+/*
+setEncodedCols() marks the encoded cols of tableInfo with their encoding (see EncodeAnnotation), and sets its EncodedCols
+(in col order). The DeltaBits of a delta or delta-of-delta encoded col are the sizes of its delta vectors.
+*/
+func setEncodedCols(tableInfo *TableInfo, encodings map[string]string) error {
+	for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+		for colName := range encodings {
+			for _, suffix := range []string{valuesSuffix, runEndsSuffix,
+				deltaSuffix + "8", deltaSuffix + "16", deltaSuffix + "32", deltaSuffix + "64",
+				deltaOfDeltaSuffix + "8", deltaOfDeltaSuffix + "16", deltaOfDeltaSuffix + "32", deltaOfDeltaSuffix + "64"} {
+				if tableInfo.Cols[colIndex].ColName == colName+suffix {
+					return fmt.Errorf("%s [%s] col %s: the encoded field name %s is the name of a col",
+						EncodeAnnotation, tableInfo.TableName, colName, colName+suffix)
+				}
+			}
+		}
+	}
+
+	for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+		var col *ColInfo = &tableInfo.Cols[colIndex]
+		encoding, isEncoded := encodings[col.ColName]
+		if !isEncoded {
+			continue
+		}
+		if col.IsDeprecated {
+			return fmt.Errorf("%s [%s] col %s is deprecated", EncodeAnnotation, tableInfo.TableName, col.ColName)
+		}
+
+		var isInteger bool = col.IsScalar && !col.IsBool && col.ColType != "float32" && col.ColType != "float64"
+		switch {
+		case isInteger:
+		case col.IsBool && encoding == EncodingRunLength:
+		default:
+			return fmt.Errorf("%s [%s] col %s is type %s: %s needs an integer col", EncodeAnnotation, tableInfo.TableName,
+				col.ColName, col.ColType, encoding)
+		}
+
+		col.Encoding = encoding
+		if encoding != EncodingRunLength {
+			for bits := 8; bits <= flatBuffersElementSizes[col.ColType]*8; bits *= 2 {
+				col.DeltaBits = append(col.DeltaBits, bits)
+			}
+		}
+		tableInfo.EncodedCols = append(tableInfo.EncodedCols, *col)
+	}
+
+	for colName := range encodings {
+		var found bool
+		for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+			found = found || tableInfo.Cols[colIndex].ColName == colName
+		}
+		if !found {
+			return fmt.Errorf("%s [%s] has no col %s", EncodeAnnotation, tableInfo.TableName, colName)
+		}
+	}
+
+	return nil
+}
+
+/*
+setReserved() sets the Reserved slots of tableInfo if it has an indexed, dictionary-encoded or encoded col:
+the slots of the placeholders from its last col vector up to the fields of its cols at colFieldsStartSlot.
+*/
+func setReserved(tableInfo *TableInfo) error {
+	if len(tableInfo.IndexCols) == 0 && len(tableInfo.DictCols) == 0 && len(tableInfo.EncodedCols) == 0 {
+		return nil
+	}
+	if len(tableInfo.Cols) > colFieldsStartSlot {
+		return fmt.Errorf("[%s] has %d cols: a table with %s, %s or %s has at most %d cols",
+			tableInfo.TableName, len(tableInfo.Cols), IndexAnnotation, DictAnnotation, EncodeAnnotation, colFieldsStartSlot)
+	}
+
+	for slot := len(tableInfo.Cols); slot < colFieldsStartSlot; slot++ {
+		var placeholder string = fmt.Sprintf(reservedColSlotFormat, slot)
+		for colIndex := 0; colIndex < len(tableInfo.Cols); colIndex++ {
+			if tableInfo.Cols[colIndex].ColName == placeholder {
+				return fmt.Errorf("[%s] col %s: %s is the name of a placeholder field", tableInfo.TableName, placeholder, placeholder)
+			}
+		}
+		tableInfo.Reserved = append(tableInfo.Reserved, slot)
+	}
+
+	return nil
+}
+
+/*
+sortedRowIndexes() returns the row indexes of table in the order of keyColNames, as the generated encoders
+write the rows: sorted stably, col by col, with strings bytewise, false before true, and float NaN first.
+With no keyColNames the rows stay in table order.
+*/
+func sortedRowIndexes(table *gotables.Table, keyColNames []string) (rowIndexes []int, err error) {
+	rowIndexes = make([]int, table.RowCount())
+	for rowIndex := 0; rowIndex < len(rowIndexes); rowIndex++ {
+		rowIndexes[rowIndex] = rowIndex
+	}
+	if len(keyColNames) == 0 {
+		return rowIndexes, nil
+	}
+
+	for _, keyColName := range keyColNames {
+		colType, err := table.ColType(keyColName)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := flatBuffersElementSizes[colType]; !exists {
+			return nil, fmt.Errorf("[%s] key col %s: unsupported FlatTables col type: %s", table.Name(), keyColName, colType)
+		}
+	}
+
+	// The key cells of each row.
+	var keys [][]interface{} = make([][]interface{}, table.RowCount())
+	for rowIndex := 0; rowIndex < len(keys); rowIndex++ {
+		keys[rowIndex] = make([]interface{}, len(keyColNames))
+		for keyIndex, keyColName := range keyColNames {
+			keys[rowIndex][keyIndex], err = table.GetVal(keyColName, rowIndex)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(rowIndexes, func(i, j int) bool {
+		return compareKeys(keys[rowIndexes[i]], keys[rowIndexes[j]]) < 0
+	})
+
+	return rowIndexes, nil
+}
+
+// compareKeys() compares keys a and b col by col, returning -1, 0 or +1.
+func compareKeys(a []interface{}, b []interface{}) int {
+	for keyIndex := 0; keyIndex < len(a); keyIndex++ {
+		if comparison := compareVals(a[keyIndex], b[keyIndex]); comparison != 0 {
+			return comparison
+		}
+	}
+	return 0
+}
+
+// compareVals() compares cells a and b of the same col type, returning -1, 0 or +1.
+func compareVals(a interface{}, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case !a:
+			return -1
+		default:
+			return 1
+		}
+	case int8:
+		return compareInt64(int64(a), int64(b.(int8)))
+	case int16:
+		return compareInt64(int64(a), int64(b.(int16)))
+	case int32:
+		return compareInt64(int64(a), int64(b.(int32)))
+	case int64:
+		return compareInt64(a, b.(int64))
+	case uint8: // Also byte.
+		return compareUint64(uint64(a), uint64(b.(uint8)))
+	case uint16:
+		return compareUint64(uint64(a), uint64(b.(uint16)))
+	case uint32:
+		return compareUint64(uint64(a), uint64(b.(uint32)))
+	case uint64:
+		return compareUint64(a, b.(uint64))
+	case float32:
+		return compareFloat64(float64(a), float64(b.(float32)))
+	case float64:
+		return compareFloat64(a, b.(float64))
+	default:
+		panic(fmt.Sprintf("unsupported FlatTables key type: %T", a)) // sortedRowIndexes() checks the col types.
+	}
+}
+
+func compareInt64(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareUint64(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareFloat64() returns -1, 0 or +1. NaN is before every other value, and equal to NaN.
+func compareFloat64(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case a == b:
+		return 0
+	case a != a && b != b:
+		return 0
+	case a != a:
+		return -1
+	default:
+		return 1
+	}
+}
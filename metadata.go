@@ -0,0 +1,155 @@
+package flattables
+
+// Self-describing FlatTables FlatBuffers, which embed the gotables metadata of their tables. See MetadataAnnotation.
+
+import (
+	"fmt"
+	"strings"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/urban-wombat/gotables"
+	"github.com/urban-wombat/util"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+metadataText() returns the metadata of tableSet: its tables with no rows, in struct shape, as gotables text.
+Tables with no cols are left out, as the encoders leave them out.
+*/
+func metadataText(tableSet *gotables.TableSet) (string, error) {
+	const copyRows = false // i.e., don't copy rows.
+	metadataTableSet, err := tableSet.Copy(copyRows)
+	if err != nil {
+		return "", err
+	}
+
+	for tableIndex := metadataTableSet.TableCount() - 1; tableIndex >= 0; tableIndex-- {
+		table, err := metadataTableSet.TableByTableIndex(tableIndex)
+		if err != nil {
+			return "", err
+		}
+
+		if table.ColCount() == 0 {
+			err = metadataTableSet.DeleteTableByTableIndex(tableIndex)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		err = table.SetStructShape(true)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return metadataTableSet.String(), nil
+}
+
+/*
+embeddedMetadata() returns metadata as FlatTables embeds it: after a first line of MetadataAnnotation, and
+annotationLines, the other annotations (see annotationLines()), which say where each table and col is in the FlatBuffers.
+*/
+func embeddedMetadata(annotationLines []string, metadata string) string {
+	var lines []string = append([]string{MetadataAnnotation}, annotationLines...)
+	return strings.Join(lines, "\n") + "\n" + metadata
+}
+
+/*
+MetadataFromFlatBuffers() returns the tables of FlatTables FlatBuffers encoded from a gotables file that
+declares MetadataAnnotation, with their names and col names and types, and no rows. It reads flatBuffers
+alone, without the package that flattablesc generated for them. The embedded metadata also has the other
+annotations of the file, so Decode() of flatBuffers with the tables returned as the schema reads the rows.
+
+The metadata is field TableSetMetadata of root table FlatTables, which is its last field (see metadataSlot()), and so
+the last field of its vtable. flatBuffers may come from an untrusted source: every offset is checked before it is read.
+FlatBuffers with no metadata (or not FlatTables) return an error.
+*/
+func MetadataFromFlatBuffers(flatBuffers []byte) (tableSet *gotables.TableSet, err error) {
+	metadata, err := embeddedMetadataOf(flatBuffers)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %v", util.FuncName(), err)
+	}
+
+	tableSet, err = gotables.NewTableSetFromString(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %v", util.FuncName(), err)
+	}
+
+	return tableSet, nil
+}
+
+// embeddedMetadataOf() returns the metadata that root table FlatTables of flatBuffers embeds, checking every offset.
+func embeddedMetadataOf(flatBuffers []byte) (metadata string, err error) {
+	var size int = len(flatBuffers)
+	within := func(pos int, length int) bool {
+		return pos >= 0 && length >= 0 && pos <= size-length
+	}
+
+	if !within(0, flatbuffers.SizeUOffsetT) {
+		return "", fmt.Errorf("flatBuffers of %d bytes is too short", size)
+	}
+	var root int = int(flatbuffers.GetUOffsetT(flatBuffers))
+	if !within(root, flatbuffers.SizeSOffsetT) {
+		return "", fmt.Errorf("root table offset %d is out of range", root)
+	}
+
+	var vtable int = root - int(flatbuffers.GetSOffsetT(flatBuffers[root:]))
+	if !within(vtable, 2*flatbuffers.SizeVOffsetT) {
+		return "", fmt.Errorf("root table vtable offset %d is out of range", vtable)
+	}
+	var vtableSize int = int(flatbuffers.GetVOffsetT(flatBuffers[vtable:]))
+	if vtableSize%flatbuffers.SizeVOffsetT != 0 || !within(vtable, vtableSize) {
+		return "", fmt.Errorf("root table vtable size %d is invalid", vtableSize)
+	}
+	if vtableSize <= 2*flatbuffers.SizeVOffsetT {
+		return "", fmt.Errorf("root table has no fields")
+	}
+
+	// The last field of the vtable, which has metadataSlot(tableCount) + 1 fields if it has the metadata.
+	var fieldCount int = vtableSize/flatbuffers.SizeVOffsetT - 2
+	var tableCount int = (fieldCount - 1) / (tableFieldCount + 1)
+	if metadataSlot(tableCount) != fieldCount-1 {
+		return "", fmt.Errorf("root table has no %s (FlatBuffers encoded without %s)", metadataField, MetadataAnnotation)
+	}
+	var field int = int(flatbuffers.GetVOffsetT(flatBuffers[vtable+int(fieldOffset(metadataSlot(tableCount))):]))
+	if field == 0 || !within(root+field, flatbuffers.SizeUOffsetT) {
+		return "", fmt.Errorf("root table has no %s", metadataField)
+	}
+	var str int = root + field + int(flatbuffers.GetUOffsetT(flatBuffers[root+field:]))
+	if !within(str, flatbuffers.SizeUOffsetT) {
+		return "", fmt.Errorf("%s offset %d is out of range", metadataField, str)
+	}
+	var length int = int(flatbuffers.GetUOffsetT(flatBuffers[str:]))
+	if !within(str+flatbuffers.SizeUOffsetT, length) {
+		return "", fmt.Errorf("%s length %d is out of range", metadataField, length)
+	}
+
+	metadata = string(flatBuffers[str+flatbuffers.SizeUOffsetT : str+flatbuffers.SizeUOffsetT+length])
+	if !strings.HasPrefix(metadata, MetadataAnnotation+"\n") {
+		return "", fmt.Errorf("root table has no %s (FlatBuffers encoded without %s)", metadataField, MetadataAnnotation)
+	}
+
+	return metadata, nil
+}
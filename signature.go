@@ -0,0 +1,210 @@
+package flattables
+
+// Signed FlatTables FlatBuffers: an envelope of the FlatBuffers bytes with a signature appended, as the generated
+// SignFlatBuffers() and VerifySignedFlatBuffers() make and check them. See Sign_template.
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/urban-wombat/util"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+A signed envelope is the FlatTables FlatBuffers bytes, then the signature of those bytes, then a trailer of
+the signature algorithm (one byte) and signatureMagic. The FlatBuffers bytes are unchanged, and start at offset 0.
+
+	<FlatBuffers bytes> <signature> <algorithm> F T S G
+
+The signature is HMAC-SHA256 (32 bytes) or Ed25519 (64 bytes) of the FlatBuffers bytes.
+*/
+const signatureMagic = "FTSG"
+
+// The algorithms of a signed envelope.
+const (
+	SignatureHMAC    = "hmac"    // HMAC-SHA256 (crypto/hmac) with a shared secret.
+	SignatureEd25519 = "ed25519" // Ed25519 (crypto/ed25519): sign with a private key, verify with its public key.
+)
+
+// The algorithm byte of the trailer of a signed envelope, and the signature length, of each algorithm.
+const (
+	signatureAlgorithmHMAC    byte = 1
+	signatureAlgorithmEd25519 byte = 2
+)
+
+var signatureSizes = map[byte]int{
+	signatureAlgorithmHMAC:    sha256.Size,
+	signatureAlgorithmEd25519: ed25519.SignatureSize,
+}
+
+var signatureAlgorithmNames = map[byte]string{
+	signatureAlgorithmHMAC:    SignatureHMAC,
+	signatureAlgorithmEd25519: SignatureEd25519,
+}
+
+// The length of the trailer of a signed envelope: the algorithm byte and signatureMagic.
+const signatureTrailerSize = 1 + len(signatureMagic)
+
+// The shortest HMAC secret accepted: as long as the HMAC-SHA256 signature.
+const minHMACSecretSize = sha256.Size
+
+/*
+SigningKey signs FlatTables FlatBuffers into a signed envelope (see SignFlatBuffers()), and verifies them
+(see VerifySignedFlatBuffers()). Make one with NewHMACKey(), NewEd25519SigningKey() or NewEd25519VerifyingKey().
+*/
+type SigningKey struct {
+	algorithm  byte
+	secret     []byte             // HMAC
+	privateKey ed25519.PrivateKey // Ed25519. Nil in a key that only verifies.
+	publicKey  ed25519.PublicKey  // Ed25519
+}
+
+// NewHMACKey() returns a SigningKey that signs and verifies with HMAC-SHA256 and secret, of at least 32 bytes.
+func NewHMACKey(secret []byte) (key SigningKey, err error) {
+	if len(secret) < minHMACSecretSize {
+		return key, fmt.Errorf("%s(): HMAC secret of %d bytes is too short (expecting at least %d)",
+			util.FuncName(), len(secret), minHMACSecretSize)
+	}
+	return SigningKey{algorithm: signatureAlgorithmHMAC, secret: append([]byte(nil), secret...)}, nil
+}
+
+// NewEd25519SigningKey() returns a SigningKey that signs with Ed25519 privateKey, and verifies with its public key.
+func NewEd25519SigningKey(privateKey ed25519.PrivateKey) (key SigningKey, err error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return key, fmt.Errorf("%s(): Ed25519 private key of %d bytes (expecting %d)",
+			util.FuncName(), len(privateKey), ed25519.PrivateKeySize)
+	}
+	return SigningKey{
+		algorithm:  signatureAlgorithmEd25519,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// NewEd25519VerifyingKey() returns a SigningKey that verifies with Ed25519 publicKey. It can't sign.
+func NewEd25519VerifyingKey(publicKey ed25519.PublicKey) (key SigningKey, err error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return key, fmt.Errorf("%s(): Ed25519 public key of %d bytes (expecting %d)",
+			util.FuncName(), len(publicKey), ed25519.PublicKeySize)
+	}
+	return SigningKey{algorithm: signatureAlgorithmEd25519, publicKey: publicKey}, nil
+}
+
+// sign() returns the signature of flatBuffers with key.
+func (key SigningKey) sign(flatBuffers []byte) (signature []byte, err error) {
+	switch key.algorithm {
+	case signatureAlgorithmHMAC:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write(flatBuffers)
+		return mac.Sum(nil), nil
+	case signatureAlgorithmEd25519:
+		if key.privateKey == nil {
+			return nil, fmt.Errorf("an Ed25519 verifying key can't sign: use NewEd25519SigningKey()")
+		}
+		return ed25519.Sign(key.privateKey, flatBuffers), nil
+	default:
+		return nil, fmt.Errorf("SigningKey has no key: use NewHMACKey(), NewEd25519SigningKey() or NewEd25519VerifyingKey()")
+	}
+}
+
+/*
+SignFlatBuffers() returns flatBuffers in a signed envelope: flatBuffers with a signature of them by key appended.
+The envelope is exactly that of the generated SignFlatBuffers() with the same key.
+*/
+func SignFlatBuffers(flatBuffers []byte, key SigningKey) (envelope []byte, err error) {
+	if len(flatBuffers) == 0 {
+		return nil, fmt.Errorf("%s(): flatBuffers []byte is empty", util.FuncName())
+	}
+
+	signature, err := key.sign(flatBuffers)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %v", util.FuncName(), err)
+	}
+
+	envelope = make([]byte, 0, len(flatBuffers)+len(signature)+signatureTrailerSize)
+	envelope = append(envelope, flatBuffers...)
+	envelope = append(envelope, signature...)
+	envelope = append(envelope, key.algorithm)
+	envelope = append(envelope, signatureMagic...)
+
+	return envelope, nil
+}
+
+/*
+VerifySignedFlatBuffers() checks the signature of signed envelope with key, and returns the FlatBuffers bytes
+it signs (a slice of envelope, not a copy). It returns an error, and no bytes, if envelope is not signed,
+is signed with another algorithm, or doesn't match its signature: so don't read envelope any other way.
+*/
+func VerifySignedFlatBuffers(envelope []byte, key SigningKey) (flatBuffers []byte, err error) {
+	flatBuffers, signature, err := splitSignedEnvelope(envelope, key.algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %v", util.FuncName(), err)
+	}
+
+	var verified bool
+	switch key.algorithm {
+	case signatureAlgorithmHMAC:
+		expected, _ := key.sign(flatBuffers)
+		verified = hmac.Equal(signature, expected)
+	case signatureAlgorithmEd25519:
+		verified = ed25519.Verify(key.publicKey, flatBuffers, signature)
+	}
+	if !verified {
+		return nil, fmt.Errorf("%s(): signature doesn't match: the FlatBuffers are tampered with, or signed with another key",
+			util.FuncName())
+	}
+
+	return flatBuffers, nil
+}
+
+// splitSignedEnvelope() returns the FlatBuffers bytes and signature of envelope, expecting algorithm.
+func splitSignedEnvelope(envelope []byte, algorithm byte) (flatBuffers []byte, signature []byte, err error) {
+	signatureSize, isAlgorithm := signatureSizes[algorithm]
+	if !isAlgorithm {
+		return nil, nil, fmt.Errorf("SigningKey has no key: use NewHMACKey(), NewEd25519SigningKey() or NewEd25519VerifyingKey()")
+	}
+
+	if len(envelope) < signatureTrailerSize || string(envelope[len(envelope)-len(signatureMagic):]) != signatureMagic {
+		return nil, nil, fmt.Errorf("not a signed envelope (no trailer %q): unsigned FlatBuffers are rejected", signatureMagic)
+	}
+	var envelopeAlgorithm byte = envelope[len(envelope)-signatureTrailerSize]
+	if envelopeAlgorithm != algorithm {
+		name, isKnown := signatureAlgorithmNames[envelopeAlgorithm]
+		if !isKnown {
+			name = fmt.Sprintf("unknown algorithm %d", envelopeAlgorithm)
+		}
+		return nil, nil, fmt.Errorf("envelope is signed with %s, not %s", name, signatureAlgorithmNames[algorithm])
+	}
+	if len(envelope) <= signatureSize+signatureTrailerSize {
+		return nil, nil, fmt.Errorf("envelope of %d bytes is too short for a %s signature and FlatBuffers",
+			len(envelope), signatureAlgorithmNames[algorithm])
+	}
+
+	// Cap the capacity of flatBuffers so that its accessors can't read on into the signature and trailer.
+	var signatureStart int = len(envelope) - signatureTrailerSize - signatureSize
+	return envelope[:signatureStart:signatureStart], envelope[signatureStart : len(envelope)-signatureTrailerSize], nil
+}
@@ -0,0 +1,291 @@
+package flattables
+
+// The stats tables that encodeTableSet() builds alongside each table, as the generated code does. See Stats_template.
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/urban-wombat/gotables"
+)
+
+/*
+Copyright (c) 2017 Malcolm Gorman
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+buildStats() builds the stats table of table in builder, and returns its (unfinished) offset.
+
+The bytes are exactly those of the build() method generated for the stats table: rowCount, then
+Min, Max and Distinct of each col that is not bool, in col order. A deprecated col keeps its (unwritten) fields.
+*/
+func buildStats(builder *flatbuffers.Builder, table *gotables.Table) (offset flatbuffers.UOffsetT, err error) {
+	var cols []*colStats = make([]*colStats, 0, table.ColCount())
+	var slots []int = make([]int, 0, table.ColCount()) // Of the Min of each of cols.
+	const fieldsPerCol = 3                             // Min, Max, Distinct
+	var slot int = 1                                   // After rowCount.
+	for colIndex := 0; colIndex < table.ColCount(); colIndex++ {
+		colName, err := table.ColNameByColIndex(colIndex)
+		if err != nil {
+			return 0, err
+		}
+		colType, err := table.ColTypeByColIndex(colIndex)
+		if err != nil {
+			return 0, err
+		}
+		if colType == "bool" {
+			continue
+		}
+		var colSlot int = slot
+		slot += fieldsPerCol
+		if isDeprecated(colName) {
+			continue
+		}
+
+		var stats *colStats = &colStats{colType: colType}
+		for rowIndex := 0; rowIndex < table.RowCount(); rowIndex++ {
+			val, err := table.GetValByColIndex(colIndex, rowIndex)
+			if err != nil {
+				return 0, err
+			}
+			err = stats.add(val)
+			if err != nil {
+				return 0, fmt.Errorf("[%s] col %d: %v", table.Name(), colIndex, err)
+			}
+		}
+		cols = append(cols, stats)
+		slots = append(slots, colSlot)
+	}
+
+	// Create the strings outside StartObject() to avoid nesting error.
+	var stringOffsets []flatbuffers.UOffsetT = make([]flatbuffers.UOffsetT, 0, 2*len(cols))
+	for _, stats := range cols {
+		if stats.colType == "string" {
+			stringOffsets = append(stringOffsets, builder.CreateString(stats.stringMin), builder.CreateString(stats.stringMax))
+		}
+	}
+
+	builder.StartObject(slot)
+	builder.PrependUint64Slot(0, uint64(table.RowCount()), 0)
+	for colIndex, stats := range cols {
+		var slot int = slots[colIndex]
+		if stats.colType == "string" {
+			builder.PrependUOffsetTSlot(slot, stringOffsets[0], 0)
+			builder.PrependUOffsetTSlot(slot+1, stringOffsets[1], 0)
+			stringOffsets = stringOffsets[2:]
+		} else {
+			stats.prependMinMax(builder, slot)
+		}
+		builder.PrependUint64Slot(slot+2, stats.distinct.estimate(), 0)
+	}
+
+	return builder.EndObject(), nil
+}
+
+// colStats accumulates the stats of a col. Its Min and Max are held in the field for the col type's kind.
+type colStats struct {
+	colType              string
+	count                int // Of the values in Min and Max, which leave out NaN.
+	intMin, intMax       int64
+	uintMin, uintMax     uint64
+	floatMin, floatMax   float64
+	stringMin, stringMax string
+	distinct             hyperLogLog
+}
+
+func (stats *colStats) add(val interface{}) error {
+	switch val := val.(type) {
+	case int8:
+		stats.addInt(int64(val))
+	case int16:
+		stats.addInt(int64(val))
+	case int32:
+		stats.addInt(int64(val))
+	case int64:
+		stats.addInt(val)
+	case uint8:
+		stats.addUint(uint64(val))
+	case uint16:
+		stats.addUint(uint64(val))
+	case uint32:
+		stats.addUint(uint64(val))
+	case uint64:
+		stats.addUint(val)
+	case float32:
+		stats.addFloat(float64(val))
+	case float64:
+		stats.addFloat(val)
+	case string:
+		if stats.count == 0 || val < stats.stringMin {
+			stats.stringMin = val
+		}
+		if stats.count == 0 || val > stats.stringMax {
+			stats.stringMax = val
+		}
+		stats.count++
+		stats.distinct.add(hashString(val))
+	default:
+		return fmt.Errorf("unsupported FlatTables col type: %s", stats.colType)
+	}
+
+	return nil
+}
+
+func (stats *colStats) addInt(val int64) {
+	if stats.count == 0 || val < stats.intMin {
+		stats.intMin = val
+	}
+	if stats.count == 0 || val > stats.intMax {
+		stats.intMax = val
+	}
+	stats.count++
+	stats.distinct.add(hashUint64(uint64(val)))
+}
+
+func (stats *colStats) addUint(val uint64) {
+	if stats.count == 0 || val < stats.uintMin {
+		stats.uintMin = val
+	}
+	if stats.count == 0 || val > stats.uintMax {
+		stats.uintMax = val
+	}
+	stats.count++
+	stats.distinct.add(hashUint64(val))
+}
+
+func (stats *colStats) addFloat(val float64) {
+	if val == val { // Not NaN.
+		if stats.count == 0 || val < stats.floatMin {
+			stats.floatMin = val
+		}
+		if stats.count == 0 || val > stats.floatMax {
+			stats.floatMax = val
+		}
+		stats.count++
+	}
+	stats.distinct.add(hashFloat64(val))
+}
+
+// prependMinMax() prepends Min and Max of a scalar col, as fields slot and slot+1.
+func (stats *colStats) prependMinMax(builder *flatbuffers.Builder, slot int) {
+	switch stats.colType {
+	case "int8":
+		builder.PrependInt8Slot(slot, int8(stats.intMin), 0)
+		builder.PrependInt8Slot(slot+1, int8(stats.intMax), 0)
+	case "int16":
+		builder.PrependInt16Slot(slot, int16(stats.intMin), 0)
+		builder.PrependInt16Slot(slot+1, int16(stats.intMax), 0)
+	case "int32":
+		builder.PrependInt32Slot(slot, int32(stats.intMin), 0)
+		builder.PrependInt32Slot(slot+1, int32(stats.intMax), 0)
+	case "int64":
+		builder.PrependInt64Slot(slot, stats.intMin, 0)
+		builder.PrependInt64Slot(slot+1, stats.intMax, 0)
+	case "byte", "uint8":
+		builder.PrependByteSlot(slot, byte(stats.uintMin), 0)
+		builder.PrependByteSlot(slot+1, byte(stats.uintMax), 0)
+	case "uint16":
+		builder.PrependUint16Slot(slot, uint16(stats.uintMin), 0)
+		builder.PrependUint16Slot(slot+1, uint16(stats.uintMax), 0)
+	case "uint32":
+		builder.PrependUint32Slot(slot, uint32(stats.uintMin), 0)
+		builder.PrependUint32Slot(slot+1, uint32(stats.uintMax), 0)
+	case "uint64":
+		builder.PrependUint64Slot(slot, stats.uintMin, 0)
+		builder.PrependUint64Slot(slot+1, stats.uintMax, 0)
+	case "float32":
+		builder.PrependFloat32Slot(slot, float32(stats.floatMin), 0)
+		builder.PrependFloat32Slot(slot+1, float32(stats.floatMax), 0)
+	case "float64":
+		builder.PrependFloat64Slot(slot, stats.floatMin, 0)
+		builder.PrependFloat64Slot(slot+1, stats.floatMax, 0)
+	}
+}
+
+// The number of bits of a hash that pick a hyperLogLog register.
+const hyperLogLogPrecision = 10
+
+/*
+hyperLogLog estimates the number of distinct values added to it, in 1 KiB.
+Each register holds the longest run of leading zero bits (plus 1) seen in the hashes it was picked by.
+*/
+type hyperLogLog [1 << hyperLogLogPrecision]uint8
+
+func (hll *hyperLogLog) add(hash uint64) {
+	var register uint64 = hash >> (64 - hyperLogLogPrecision)
+	// The sentinel bit limits the run to the bits left after the register bits.
+	var rank uint8 = uint8(bits.LeadingZeros64(hash<<hyperLogLogPrecision|1<<(hyperLogLogPrecision-1))) + 1
+	if rank > hll[register] {
+		hll[register] = rank
+	}
+}
+
+func (hll *hyperLogLog) estimate() uint64 {
+	const registerCount = float64(len(hll))
+
+	var sum float64
+	var zeroCount int
+	for _, rank := range hll {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeroCount++
+		}
+	}
+
+	var alpha float64 = 0.7213 / (1 + 1.079/registerCount)
+	var estimate float64 = alpha * registerCount * registerCount / sum
+
+	// Small counts are estimated more accurately by linear counting of the empty registers.
+	if estimate <= 2.5*registerCount && zeroCount > 0 {
+		estimate = registerCount * math.Log(registerCount/float64(zeroCount))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// hashUint64() mixes the bits of x (as the SplitMix64 finalizer does), so that similar values hash far apart.
+func hashUint64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func hashFloat64(x float64) uint64 {
+	if x == 0 {
+		x = 0 // -0 and +0 are the same value.
+	}
+	return hashUint64(math.Float64bits(x))
+}
+
+// hashString() hashes s with 64-bit FNV-1a, then mixes the bits.
+func hashString(s string) uint64 {
+	var hash uint64 = 14695981039346656037
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= 1099511628211
+	}
+	return hashUint64(hash)
+}